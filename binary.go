@@ -0,0 +1,240 @@
+package chester
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// PositionSize is the size in bytes of a position encoded by
+// [Position.MarshalBinary].
+const PositionSize = 32
+
+// ErrInvalidPosition is returned when encoding or decoding a position that
+// can't be represented in binary form.
+var ErrInvalidPosition = errors.New("invalid position")
+
+// MarshalBinary encodes the position in [PositionSize] bytes:
+//
+//	bytes  0-7   occupancy bitboard, little endian, bit 0 is a8
+//	bytes  8-23  one nibble per occupied square, in square order, low
+//	             nibble first, holding color<<3 | piece; unused nibbles
+//	             are zero
+//	byte   24    bit 0 set when black is to move, bits 1-4 the castling
+//	             rights: white king side, white queen side, black king
+//	             side, black queen side
+//	byte   25    en passant target square, 64 when there is none
+//	byte   26    half-move clock
+//	bytes 27-28  full-move counter, little endian
+//	bytes 29-31  zero
+//
+// Positions with more than 32 pieces can't be encoded.
+func (p *Position) MarshalBinary() ([]byte, error) {
+	return p.AppendBinary(make([]byte, 0, PositionSize))
+}
+
+// AppendBinary appends the encoding of [Position.MarshalBinary] to b.
+func (p *Position) AppendBinary(b []byte) ([]byte, error) {
+	occupied := p.allPieces[White] | p.allPieces[Black]
+	if occupied.OnesCount() > 32 {
+		return b, fmt.Errorf("%w: more than 32 pieces", ErrInvalidPosition)
+	}
+
+	var data [PositionSize]byte
+	binary.LittleEndian.PutUint64(data[0:], uint64(occupied))
+
+	i := 0
+	for bb := occupied; bb != 0; i++ {
+		var sq Square
+		sq, bb = bb.PopLSB()
+
+		nibble := byte(p.mailbox[sq])
+		if p.allPieces[Black]&NewBitboardFromSquare(sq) != 0 {
+			nibble |= 8
+		}
+		data[8+i/2] |= nibble << (4 * (i % 2))
+	}
+
+	data[24] = byte(p.active) | byte(p.castlingRights)<<1
+	data[25] = byte(p.enPassantTarget)
+	data[26] = p.halfMoves
+	binary.LittleEndian.PutUint16(data[27:], p.fullMoves)
+
+	return append(b, data[:]...), nil
+}
+
+// UnmarshalBinary decodes a position encoded by [Position.MarshalBinary].
+// It returns [ErrInvalidPosition] when the data doesn't hold a position
+// moves can be played from: each side must have one king, pawns can't be
+// on the first or last rank, the side not to move can't be in check, and
+// the castling rights and en passant target must match the board. Any
+// observer attached to p is detached.
+func (p *Position) UnmarshalBinary(data []byte) error {
+	if len(data) != PositionSize {
+		return fmt.Errorf("%w: %d bytes", ErrInvalidPosition, len(data))
+	}
+	if data[24]>>5 != 0 || data[25] > byte(SQ_NULL) || data[29]|data[30]|data[31] != 0 {
+		return fmt.Errorf("%w: bad state", ErrInvalidPosition)
+	}
+
+	occupied := Bitboard(binary.LittleEndian.Uint64(data))
+	if occupied.OnesCount() > 32 {
+		return fmt.Errorf("%w: more than 32 pieces", ErrInvalidPosition)
+	}
+
+	var pos Position
+	for i := range pos.mailbox {
+		pos.mailbox[i] = Empty
+	}
+
+	i := 0
+	for bb := occupied; bb != 0; i++ {
+		var sq Square
+		sq, bb = bb.PopLSB()
+
+		nibble := data[8+i/2] >> (4 * (i % 2)) & 15
+		piece, color := Piece(nibble&7), Color(nibble>>3)
+		if piece > King {
+			return fmt.Errorf("%w: bad piece on %s", ErrInvalidPosition, sq)
+		}
+
+		pos.mailbox[sq] = piece
+		pos.pieces[piece] |= NewBitboardFromSquare(sq)
+		pos.allPieces[color] |= NewBitboardFromSquare(sq)
+	}
+
+	pos.active = Color(data[24] & 1)
+	pos.inactive = pos.active ^ 1
+	pos.castlingRights = castlingRights(data[24] >> 1)
+	pos.enPassantTarget = Square(data[25])
+	pos.halfMoves = data[26]
+	pos.fullMoves = binary.LittleEndian.Uint16(data[27:])
+
+	if err := pos.validate(); err != nil {
+		return err
+	}
+
+	pos.hash = computeHash(&pos)
+	pos.pawnHash = computePawnHash(&pos)
+	pos.materialHash = computeMaterialHash(&pos)
+
+	*p = pos
+	return nil
+}
+
+// castlingSquares are the squares the king and the rook of each castling
+// right start from.
+var castlingSquares = [...]struct {
+	right      castlingRights
+	color      Color
+	king, rook Square
+}{
+	{whiteKingSideCastle, White, SQ_E1, SQ_H1},
+	{whiteQueenSideCastle, White, SQ_E1, SQ_A1},
+	{blackKingSideCastle, Black, SQ_E8, SQ_H8},
+	{blackQueenSideCastle, Black, SQ_E8, SQ_A8},
+}
+
+// validate checks that moves can be generated and played from a decoded
+// position: each side has one king and at most 16 pieces, 8 of them pawns,
+// no pawn is on the first or last rank, the side that just moved isn't in
+// check, and the castling rights and the en passant target match the
+// board.
+func (p *Position) validate() error {
+	for color := range Color(2) {
+		own := p.allPieces[color]
+		if (p.pieces[King] & own).OnesCount() != 1 {
+			return fmt.Errorf("%w: not one king per side", ErrInvalidPosition)
+		}
+		if own.OnesCount() > 16 || (p.pieces[Pawn]&own).OnesCount() > 8 {
+			return fmt.Errorf("%w: too many pieces per side", ErrInvalidPosition)
+		}
+	}
+
+	if p.pieces[Pawn]&(Rank_1|Rank_8) != 0 {
+		return fmt.Errorf("%w: pawn on the first or last rank", ErrInvalidPosition)
+	}
+
+	occupied := p.allPieces[White] | p.allPieces[Black]
+	if attackersTo(p, kingSquare(p, p.inactive), occupied)&p.allPieces[p.active] != 0 {
+		return fmt.Errorf("%w: side not to move in check", ErrInvalidPosition)
+	}
+
+	for _, c := range castlingSquares {
+		if p.castlingRights&c.right == 0 {
+			continue
+		}
+		own := p.allPieces[c.color]
+		if p.pieces[King]&own&NewBitboardFromSquare(c.king) == 0 || p.pieces[Rook]&own&NewBitboardFromSquare(c.rook) == 0 {
+			return fmt.Errorf("%w: castling rights without king and rook", ErrInvalidPosition)
+		}
+	}
+
+	if ep := p.enPassantTarget; ep != SQ_NULL {
+		// the pawn of the side not to move just pushed two squares
+		// past the target
+		rank, pawnSq, from := Rank_6, ep+8, ep-8
+		if p.active == Black {
+			rank, pawnSq, from = Rank_3, ep-8, ep+8
+		}
+		if NewBitboardFromSquare(ep)&rank == 0 {
+			return fmt.Errorf("%w: bad en passant target", ErrInvalidPosition)
+		}
+		if occupied&(NewBitboardFromSquare(ep)|NewBitboardFromSquare(from)) != 0 ||
+			p.pieces[Pawn]&p.allPieces[p.inactive]&NewBitboardFromSquare(pawnSq) == 0 {
+			return fmt.Errorf("%w: bad en passant target", ErrInvalidPosition)
+		}
+	}
+	return nil
+}
+
+// PositionWriter writes positions to a stream, one after the other in the
+// format of [Position.MarshalBinary]. Writes are buffered, Flush must be
+// called once done.
+type PositionWriter struct {
+	w   *bufio.Writer
+	buf []byte
+}
+
+// NewPositionWriter returns a writer writing positions to w.
+func NewPositionWriter(w io.Writer) *PositionWriter {
+	return &PositionWriter{w: bufio.NewWriter(w), buf: make([]byte, 0, PositionSize)}
+}
+
+// Write writes p to the stream.
+func (pw *PositionWriter) Write(p *Position) error {
+	var err error
+	if pw.buf, err = p.AppendBinary(pw.buf[:0]); err != nil {
+		return err
+	}
+	_, err = pw.w.Write(pw.buf)
+	return err
+}
+
+// Flush writes any buffered data to the underlying writer.
+func (pw *PositionWriter) Flush() error {
+	return pw.w.Flush()
+}
+
+// PositionReader reads positions written by a [PositionWriter].
+type PositionReader struct {
+	r   *bufio.Reader
+	buf [PositionSize]byte
+}
+
+// NewPositionReader returns a reader reading positions from r.
+func NewPositionReader(r io.Reader) *PositionReader {
+	return &PositionReader{r: bufio.NewReader(r)}
+}
+
+// Read reads the next position into p. It returns [io.EOF] when there are
+// no more positions and [io.ErrUnexpectedEOF] when the stream ends in the
+// middle of one.
+func (pr *PositionReader) Read(p *Position) error {
+	if _, err := io.ReadFull(pr.r, pr.buf[:]); err != nil {
+		return err
+	}
+	return p.UnmarshalBinary(pr.buf[:])
+}
@@ -0,0 +1,161 @@
+package chester_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/bluescreen10/chester"
+)
+
+var binaryFENs = []string{
+	chester.DefaultFEN,
+	"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+	"rnbqkbnr/p1pppppp/8/8/1p6/8/PPPPPPPP/RNBQKBNR w Kq - 0 3",
+	"rnbqkb1r/p1pppppp/7n/Pp6/8/8/1PPPPPPP/RNBQKBNR w KQkq b6 0 4",
+	"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 b - - 37 260",
+	"8/8/8/4k3/8/8/8/4K3 w - - 100 1000",
+}
+
+// encode returns the binary encoding of fen.
+func encode(fen string) []byte {
+	p, _ := chester.ParseFEN(fen)
+	data, _ := p.MarshalBinary()
+	return data
+}
+
+func TestPosition_MarshalBinary(t *testing.T) {
+	for _, fen := range binaryFENs {
+		p, _ := chester.ParseFEN(fen)
+
+		data, err := p.MarshalBinary()
+		if err != nil {
+			t.Fatalf("%s: got error %v", fen, err)
+		}
+		if len(data) != chester.PositionSize {
+			t.Fatalf("%s: got %d bytes, want %d", fen, len(data), chester.PositionSize)
+		}
+
+		var got chester.Position
+		if err := got.UnmarshalBinary(data); err != nil {
+			t.Fatalf("%s: got error %v", fen, err)
+		}
+		if got.FEN() != fen {
+			t.Errorf("got %s, want %s", got.FEN(), fen)
+		}
+		if got.Hash() != p.Hash() || got.PawnHash() != p.PawnHash() || got.MaterialHash() != p.MaterialHash() {
+			t.Errorf("%s: hashes differ after decoding", fen)
+		}
+	}
+}
+
+func TestPosition_MarshalBinary_TooManyPieces(t *testing.T) {
+	p, _ := chester.ParseFEN("rnbqkbnr/pppppppp/8/8/8/7P/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
+	if _, err := p.MarshalBinary(); !errors.Is(err, chester.ErrInvalidPosition) {
+		t.Errorf("got error %v, want %v", err, chester.ErrInvalidPosition)
+	}
+}
+
+func TestPosition_UnmarshalBinary_Invalid(t *testing.T) {
+	p, _ := chester.ParseFEN(chester.DefaultFEN)
+	valid, _ := p.MarshalBinary()
+
+	corrupt := func(i int, b byte) []byte {
+		data := bytes.Clone(valid)
+		data[i] = b
+		return data
+	}
+
+	tests := map[string][]byte{
+		"short":           valid[:31],
+		"long":            append(bytes.Clone(valid), 0),
+		"piece":           corrupt(8, 0x77),
+		"castling":        corrupt(24, 0xff),
+		"en passant":      corrupt(25, 65),
+		"reserved":        corrupt(31, 1),
+		"too many pieces": corrupt(4, 0xff),
+		"no kings":        append([]byte{3}, make([]byte, chester.PositionSize-1)...),
+		"two kings":       encode("4k3/8/8/8/8/8/8/K3K3 w - - 0 1"),
+		"back rank pawn":  encode("P3k3/8/8/8/8/8/8/4K3 w - - 0 1"),
+		"king in check":   encode("4k3/8/8/8/8/8/8/4R1K1 w - - 0 1"),
+		"castling rook":   encode("4k3/8/8/8/8/8/8/4K3 w K - 0 1"),
+		"en passant pawn": encode("4k3/8/8/8/8/8/8/4K3 w - e6 0 1"),
+		"en passant rank": encode("4k3/8/8/4p3/8/8/8/4K3 w - e5 0 1"),
+	}
+
+	for name, data := range tests {
+		var got chester.Position
+		if err := got.UnmarshalBinary(data); !errors.Is(err, chester.ErrInvalidPosition) {
+			t.Errorf("%s: got error %v, want %v", name, err, chester.ErrInvalidPosition)
+		}
+	}
+}
+
+func TestPositionWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := chester.NewPositionWriter(&buf)
+	for _, fen := range binaryFENs {
+		p, _ := chester.ParseFEN(fen)
+		if err := w.Write(p); err != nil {
+			t.Fatalf("%s: got error %v", fen, err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if buf.Len() != len(binaryFENs)*chester.PositionSize {
+		t.Fatalf("got %d bytes, want %d", buf.Len(), len(binaryFENs)*chester.PositionSize)
+	}
+
+	// the last position is cut short
+	data := buf.Bytes()[:buf.Len()-1]
+
+	r := chester.NewPositionReader(bytes.NewReader(data))
+	var p chester.Position
+	for _, fen := range binaryFENs[:len(binaryFENs)-1] {
+		if err := r.Read(&p); err != nil {
+			t.Fatalf("got error %v", err)
+		}
+		if p.FEN() != fen {
+			t.Errorf("got %s, want %s", p.FEN(), fen)
+		}
+	}
+	if err := r.Read(&p); err != io.ErrUnexpectedEOF {
+		t.Errorf("got error %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+
+	r = chester.NewPositionReader(bytes.NewReader(nil))
+	if err := r.Read(&p); err != io.EOF {
+		t.Errorf("got error %v, want %v", err, io.EOF)
+	}
+}
+
+func FuzzPosition_UnmarshalBinary(f *testing.F) {
+	for _, fen := range binaryFENs {
+		f.Add(encode(fen))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var p chester.Position
+		if err := p.UnmarshalBinary(data); err != nil {
+			if !errors.Is(err, chester.ErrInvalidPosition) {
+				t.Fatalf("got error %v, want %v", err, chester.ErrInvalidPosition)
+			}
+			return
+		}
+
+		// any decoded position can be played from
+		moves, _ := chester.LegalMoves(nil, &p)
+		for _, m := range moves {
+			child := p
+			child.Do(m)
+			chester.LegalMoves(nil, &child)
+		}
+
+		var again chester.Position
+		if err := again.UnmarshalBinary(encode(p.FEN())); err != nil || again.FEN() != p.FEN() {
+			t.Fatalf("%s: got %s, error %v after encoding again", p.FEN(), again.FEN(), err)
+		}
+	})
+}
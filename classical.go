@@ -0,0 +1,365 @@
+package chester
+
+// evalScore is a pair of midgame and endgame values, interpolated by the
+// game phase into the final score.
+type evalScore struct {
+	mg, eg int
+}
+
+// evalTerm identifies a term of the classical evaluation.
+type evalTerm int
+
+const (
+	termMaterial evalTerm = iota // PeSTO material and piece-square tables
+	termPassedPawns
+	termIsolatedPawns
+	termDoubledPawns
+	termBackwardPawns
+	termBishopPair
+	termRooks
+	termOutposts
+	termMobility
+	termKingSafety
+	termThreats
+	termTempo
+	termCount
+)
+
+// Weights of the classical evaluation terms.
+var (
+	// passedPawnBonus is indexed by the relative rank of the pawn.
+	passedPawnBonus = [8]evalScore{{0, 0}, {0, 5}, {5, 10}, {10, 20}, {20, 40}, {40, 80}, {70, 130}, {0, 0}}
+
+	isolatedPawnPenalty = evalScore{-8, -12}
+	doubledPawnPenalty  = evalScore{-10, -20}
+	backwardPawnPenalty = evalScore{-8, -10}
+
+	bishopPairBonus = evalScore{30, 50}
+
+	rookOpenFileBonus     = evalScore{35, 10}
+	rookSemiOpenFileBonus = evalScore{15, 8}
+	rookOnSeventhBonus    = evalScore{10, 25}
+
+	knightOutpostBonus = evalScore{25, 15}
+
+	// mobilityBonus is the bonus per square a piece attacks beyond
+	// mobilityBase, not counting squares occupied by own pieces or
+	// attacked by enemy pawns.
+	mobilityBonus = [Piece(6)]evalScore{{}, {4, 4}, {5, 5}, {3, 5}, {1, 3}, {}}
+	mobilityBase  = [Piece(6)]int{0, 4, 6, 7, 13, 0}
+
+	// kingAttackWeight is the number of attack units added per square of
+	// the enemy king zone attacked by each piece type. The penalty grows
+	// with the square of the units once two or more pieces take part.
+	kingAttackWeight  = [Piece(6)]int{0, 2, 2, 3, 5, 0}
+	maxKingDanger     = 600
+	pawnShieldBonus   = evalScore{12, 0}
+	hangingPieceBonus = evalScore{35, 20}
+	pawnThreatBonus   = evalScore{50, 30}
+
+	tempoBonus = evalScore{20, 10}
+)
+
+// Masks used by the classical evaluation, indexed by color and square.
+var (
+	// fileMask holds the squares of each file.
+	fileMask [8]Bitboard
+
+	// adjacentFilesMask holds the squares of the files next to each file.
+	adjacentFilesMask [8]Bitboard
+
+	// forwardRanksMask holds the squares of the ranks ahead of each
+	// rank (0=rank1 .. 7=rank8), from the point of view of color.
+	forwardRanksMask [Color(2)][8]Bitboard
+
+	// forwardFileMask holds the squares ahead of a square on its file.
+	forwardFileMask [Color(2)][64]Bitboard
+
+	// passedPawnMask holds the squares ahead of a square on its file and
+	// the adjacent ones, which must be free of enemy pawns for a pawn on
+	// the square to be passed.
+	passedPawnMask [Color(2)][64]Bitboard
+)
+
+func init() {
+	for file := range 8 {
+		fileMask[file] = File_A << file
+	}
+
+	for file := range 8 {
+		if file > 0 {
+			adjacentFilesMask[file] |= fileMask[file-1]
+		}
+		if file < 7 {
+			adjacentFilesMask[file] |= fileMask[file+1]
+		}
+	}
+
+	for rank := range 8 {
+		for r := range 8 {
+			mask := Rank_1 >> (8 * r)
+			if r > rank {
+				forwardRanksMask[White][rank] |= mask
+			}
+			if r < rank {
+				forwardRanksMask[Black][rank] |= mask
+			}
+		}
+	}
+
+	for color := range Color(2) {
+		for sq := range Square(64) {
+			rank, file := sq.RankAndFile()
+			forwardFileMask[color][sq] = forwardRanksMask[color][rank] & fileMask[file]
+			passedPawnMask[color][sq] = forwardRanksMask[color][rank] & (fileMask[file] | adjacentFilesMask[file])
+		}
+	}
+}
+
+// relativeRank returns the rank of sq (0 .. 7) from the point of view of
+// color.
+func relativeRank(color Color, sq Square) int {
+	if color == White {
+		return int(sq.Rank())
+	}
+	return 7 - int(sq.Rank())
+}
+
+// classicalEval holds the state of a classical evaluation.
+type classicalEval struct {
+	p *Position
+
+	// pawns holds the pawn structure terms, from the pawn table.
+	pawns *PawnEntry
+
+	// terms accumulates the score of every term per color.
+	terms [termCount][Color(2)]evalScore
+
+	// attacks holds the squares attacked by each piece type of each
+	// color, attacked the union of them.
+	attacks  [Color(2)][Piece(6)]Bitboard
+	attacked [Color(2)]Bitboard
+
+	// kingZone is the king square plus the squares around it.
+	kingZone [Color(2)]Bitboard
+
+	// kingAttackers and kingUnits count the pieces of each color
+	// attacking the enemy king zone and the attack units they add.
+	kingAttackers [Color(2)]int
+	kingUnits     [Color(2)]int
+}
+
+// EvalClassical is a tapered evaluation built on top of the PeSTO tables.
+// On top of material and piece placement it scores pawn structure
+// (passed, isolated, doubled and backward pawns), the bishop pair, rooks on
+// open files and the 7th rank, knight outposts, mobility, king safety,
+// threats against hanging pieces and a tempo bonus. It can be used as
+// [SearchOptions.EvalFunc].
+func EvalClassical(p *Position) int {
+	var e classicalEval
+	e.evaluate(p)
+	return e.score()
+}
+
+// add adds n times s to term for color.
+func (e *classicalEval) add(term evalTerm, color Color, s evalScore, n int) {
+	e.terms[term][color].mg += s.mg * n
+	e.terms[term][color].eg += s.eg * n
+}
+
+// evaluate computes every term of the evaluation of p.
+func (e *classicalEval) evaluate(p *Position) {
+	e.p = p
+	e.pawns = classicalPawnTable().Probe(p)
+
+	for color := range Color(2) {
+		e.initAttacks(color)
+	}
+
+	for color := range Color(2) {
+		e.evaluateMaterial(color)
+		e.evaluatePawns(color)
+		e.evaluatePieces(color)
+		e.evaluateKing(color)
+		e.evaluateThreats(color)
+	}
+
+	e.add(termTempo, p.active, tempoBonus, 1)
+}
+
+// score returns the evaluation from the side to move perspective,
+// interpolated by the game phase.
+func (e *classicalEval) score() int {
+	var mg, eg int
+	for term := range termCount {
+		mg += e.terms[term][White].mg - e.terms[term][Black].mg
+		eg += e.terms[term][White].eg - e.terms[term][Black].eg
+	}
+
+	mgPhase := e.phase()
+	score := (mg*mgPhase + eg*(24-mgPhase)) / 24
+	if e.p.active == Black {
+		return -score
+	}
+	return score
+}
+
+// phase returns the game phase, from 24 in the opening to 0 when only
+// kings and pawns are left.
+func (e *classicalEval) phase() int {
+	phase := 0
+	for piece := Knight; piece <= Queen; piece++ {
+		phase += e.p.pieces[piece].OnesCount() * gamephaseInc[piece]
+	}
+	return min(phase, 24)
+}
+
+// initAttacks computes the attack maps of color and the king zone
+// attacks it takes part in.
+func (e *classicalEval) initAttacks(color Color) {
+	p := e.p
+	own := p.allPieces[color]
+	occupied := p.Occupied()
+
+	kingSq, _ := (p.pieces[King] & own).PopLSB()
+	e.kingZone[color] = kingMoves[kingSq] | NewBitboardFromSquare(kingSq)
+	e.attacks[color][King] = kingMoves[kingSq]
+	e.attacks[color][Pawn] = e.pawns.Attacks[color]
+	e.attacked[color] = e.attacks[color][King] | e.attacks[color][Pawn]
+
+	enemyZone := func() Bitboard {
+		enemyKing, _ := (p.pieces[King] & p.allPieces[color^1]).PopLSB()
+		return kingMoves[enemyKing] | NewBitboardFromSquare(enemyKing)
+	}()
+
+	for piece := Knight; piece <= Queen; piece++ {
+		bb := p.pieces[piece] & own
+		for bb != 0 {
+			var sq Square
+			sq, bb = bb.PopLSB()
+			attacks := pieceAttacks(piece, sq, occupied)
+			e.attacks[color][piece] |= attacks
+			e.attacked[color] |= attacks
+
+			if zone := attacks & enemyZone; zone != 0 {
+				e.kingAttackers[color]++
+				e.kingUnits[color] += kingAttackWeight[piece] * zone.OnesCount()
+			}
+		}
+	}
+}
+
+// pieceAttacks returns the squares attacked by a knight, bishop, rook or
+// queen on sq.
+func pieceAttacks(piece Piece, sq Square, occupied Bitboard) Bitboard {
+	switch piece {
+	case Knight:
+		return knightMoves[sq]
+	case Bishop:
+		return genBishopAttacks(sq, occupied)
+	case Rook:
+		return genRookAttacks(sq, occupied)
+	default:
+		return genBishopAttacks(sq, occupied) | genRookAttacks(sq, occupied)
+	}
+}
+
+// evaluateMaterial scores the material and piece placement of color using
+// the PeSTO tables.
+func (e *classicalEval) evaluateMaterial(color Color) {
+	for piece := Pawn; piece <= King; piece++ {
+		bb := e.p.pieces[piece] & e.p.allPieces[color]
+		for bb != 0 {
+			var sq Square
+			sq, bb = bb.PopLSB()
+			e.add(termMaterial, color, evalScore{pesto.mg[color][piece][sq], pesto.eg[color][piece][sq]}, 1)
+		}
+	}
+}
+
+// evaluatePawns scores the pawn structure of color, as cached in the pawn
+// table.
+func (e *classicalEval) evaluatePawns(color Color) {
+	for term := range pawnTermCount {
+		e.terms[termPassedPawns+term][color] = e.pawns.terms[term][color]
+	}
+}
+
+// evaluatePieces scores the bishop pair, rooks, knight outposts and the
+// mobility of the pieces of color.
+func (e *classicalEval) evaluatePieces(color Color) {
+	p := e.p
+	own := p.allPieces[color]
+	ownPawns := p.pieces[Pawn] & own
+	enemyPawns := p.pieces[Pawn] & p.allPieces[color^1]
+	occupied := p.Occupied()
+	mobilityArea := ^own &^ e.attacks[color^1][Pawn]
+
+	if (p.pieces[Bishop] & own).OnesCount() >= 2 {
+		e.add(termBishopPair, color, bishopPairBonus, 1)
+	}
+
+	for piece := Knight; piece <= Queen; piece++ {
+		bb := p.pieces[piece] & own
+		for bb != 0 {
+			var sq Square
+			sq, bb = bb.PopLSB()
+			rank, file := sq.RankAndFile()
+
+			mobility := (pieceAttacks(piece, sq, occupied) & mobilityArea).OnesCount()
+			e.add(termMobility, color, mobilityBonus[piece], mobility-mobilityBase[piece])
+
+			switch piece {
+			case Knight:
+				// an outpost is supported by a pawn and can't be
+				// attacked by enemy pawns
+				relative := relativeRank(color, sq)
+				supported := NewBitboardFromSquare(sq)&e.attacks[color][Pawn] != 0
+				safe := forwardRanksMask[color][rank]&adjacentFilesMask[file]&enemyPawns == 0
+				if relative >= 3 && relative <= 5 && supported && safe {
+					e.add(termOutposts, color, knightOutpostBonus, 1)
+				}
+			case Rook:
+				if fileMask[file]&ownPawns == 0 {
+					if fileMask[file]&enemyPawns == 0 {
+						e.add(termRooks, color, rookOpenFileBonus, 1)
+					} else {
+						e.add(termRooks, color, rookSemiOpenFileBonus, 1)
+					}
+				}
+				if relativeRank(color, sq) == 6 {
+					e.add(termRooks, color, rookOnSeventhBonus, 1)
+				}
+			}
+		}
+	}
+}
+
+// evaluateKing scores the safety of the king of color: the pawn shield in
+// front of it and the attacks of the enemy pieces on the king zone.
+func (e *classicalEval) evaluateKing(color Color) {
+	p := e.p
+	kingSq, _ := (p.pieces[King] & p.allPieces[color]).PopLSB()
+	e.add(termKingSafety, color, pawnShieldBonus, e.pawns.Shelter(color, kingSq))
+
+	enemy := color ^ 1
+	if e.kingAttackers[enemy] >= 2 {
+		units := e.kingUnits[enemy]
+		danger := min(units*units, maxKingDanger)
+		e.add(termKingSafety, color, evalScore{-danger, 0}, 1)
+	}
+}
+
+// evaluateThreats scores the threats of color: enemy pieces attacked and
+// not defended, and pieces attacked by pawns.
+func (e *classicalEval) evaluateThreats(color Color) {
+	p := e.p
+	enemy := color ^ 1
+	enemyPieces := p.allPieces[enemy] &^ p.pieces[King]
+
+	hanging := enemyPieces & e.attacked[color] &^ e.attacked[enemy]
+	e.add(termThreats, color, hangingPieceBonus, hanging.OnesCount())
+
+	attackedByPawns := enemyPieces &^ p.pieces[Pawn] & e.attacks[color][Pawn]
+	e.add(termThreats, color, pawnThreatBonus, attackedByPawns.OnesCount())
+}
@@ -0,0 +1,149 @@
+package chester_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bluescreen10/chester"
+)
+
+// mirrorFEN returns the FEN of the position with colors swapped and the
+// board flipped vertically, which must evaluate the same.
+func mirrorFEN(fen string) string {
+	parts := strings.Fields(fen)
+
+	ranks := strings.Split(parts[0], "/")
+	for i, j := 0, len(ranks)-1; i < j; i, j = i+1, j-1 {
+		ranks[i], ranks[j] = ranks[j], ranks[i]
+	}
+	parts[0] = swapCase(strings.Join(ranks, "/"))
+
+	if parts[1] == "w" {
+		parts[1] = "b"
+	} else {
+		parts[1] = "w"
+	}
+
+	if parts[2] != "-" {
+		castling := []byte(swapCase(parts[2]))
+		// keep the canonical KQkq order
+		var upper, lower []byte
+		for _, c := range castling {
+			if c >= 'a' {
+				lower = append(lower, c)
+			} else {
+				upper = append(upper, c)
+			}
+		}
+		parts[2] = string(upper) + string(lower)
+	}
+
+	if parts[3] != "-" {
+		rank := '9' - rune(parts[3][1]) + '0'
+		parts[3] = string(parts[3][0]) + string(rank)
+	}
+
+	return strings.Join(parts, " ")
+}
+
+func swapCase(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return r
+	}, s)
+}
+
+func TestEvalClassical(t *testing.T) {
+	p, _ := chester.ParseFEN(chester.DefaultFEN)
+
+	// only the tempo bonus breaks the symmetry of the start position
+	if got := chester.EvalClassical(p); got != 20 {
+		t.Errorf("got %d for the start position, want 20", got)
+	}
+}
+
+func TestEvalClassical_Symmetry(t *testing.T) {
+	fens := []string{
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"r2q1rk1/ppp2ppp/2np1n2/2b1p1B1/2B1P1b1/2NP1N2/PPP2PPP/R2Q1RK1 w - - 0 8",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+		"rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8",
+		"6k1/5ppp/8/3N4/2P5/8/R4PPP/6K1 b - - 0 1",
+	}
+
+	for _, fen := range fens {
+		p, _ := chester.ParseFEN(fen)
+		mirror, err := chester.ParseFEN(mirrorFEN(fen))
+		if err != nil {
+			t.Fatalf("%s: %v", fen, err)
+		}
+
+		if got, want := chester.EvalClassical(mirror), chester.EvalClassical(p); got != want {
+			t.Errorf("%s: got %d for the mirrored position, want %d", fen, got, want)
+		}
+	}
+}
+
+func TestEvalClassical_Terms(t *testing.T) {
+	tests := []struct {
+		name   string
+		better string
+		worse  string
+	}{
+		{
+			name:   "passed pawn",
+			better: "4k3/p7/8/3P4/8/8/8/4K3 w - - 0 1",
+			worse:  "4k3/2p5/8/3P4/8/8/8/4K3 w - - 0 1",
+		},
+		{
+			name:   "doubled pawns",
+			better: "4k3/pp6/8/8/8/8/PP6/4K3 w - - 0 1",
+			worse:  "4k3/pp6/8/8/8/P7/P7/4K3 w - - 0 1",
+		},
+		{
+			name:   "rook on open file",
+			better: "4k3/ppp5/8/8/8/8/PPP5/3RK3 w - - 0 1",
+			worse:  "4k3/ppp5/8/8/8/8/PPP5/1R2K3 w - - 0 1",
+		},
+		{
+			name:   "pawn shield",
+			better: "6k1/5ppp/8/8/8/8/5PPP/6K1 w - - 0 1",
+			worse:  "6k1/5ppp/8/8/5PPP/8/8/6K1 w - - 0 1",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			better, _ := chester.ParseFEN(test.better)
+			worse, _ := chester.ParseFEN(test.worse)
+
+			if b, w := chester.EvalClassical(better), chester.EvalClassical(worse); b <= w {
+				t.Errorf("got %d for %s, want more than %d for %s", b, test.better, w, test.worse)
+			}
+		})
+	}
+}
+
+func TestEvalClassical_Search(t *testing.T) {
+	p, _ := chester.ParseFEN("r1bqkb1r/pppp1ppp/2n2n2/4p2Q/2B1P3/8/PPPP1PPP/RNB1K1NR w KQkq - 0 1")
+	opts := &chester.SearchOptions{
+		MaxDepth: 3,
+		EvalFunc: chester.EvalClassical,
+	}
+
+	ch, _ := chester.SearchBestMove(p, opts)
+
+	var lastEval chester.Evaluation
+	for e := range ch {
+		lastEval = e
+	}
+
+	if lastEval.Best.String() != "h5f7" {
+		t.Errorf("got move %s, want h5f7", lastEval.Best)
+	}
+}
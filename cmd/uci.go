@@ -2,8 +2,9 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
-	"math"
 	"os"
 	"os/signal"
 	"runtime/pprof"
@@ -20,19 +21,19 @@ import (
 // GUI. It manages the engine's state, position, and search execution.
 type UCIServer struct {
 	mutex          sync.Mutex
-	pos            *chester.Position
-	bestMove       string
+	engine         *chester.Engine
 	isCPUProfiling bool
 	CPUProfileFile *os.File
 	isDebugLogging bool
-	tt             *chester.TranspositionTable
-	stopFunc       func()
+
+	// search tracks the goroutine running the current search until it has
+	// sent its bestmove.
+	search sync.WaitGroup
 }
 
 // startUCI initializes a standard UCI session.
 func startUCI() {
-	pos, _ := chester.ParseFEN(chester.DefaultFEN)
-	uci := &UCIServer{pos: pos, tt: chester.NewTranspositionTable(64 * 1024 * 1024)}
+	uci := &UCIServer{engine: chester.NewEngine()}
 	uci.Start()
 }
 
@@ -70,10 +71,16 @@ func (s *UCIServer) Start() {
 			s.handleGo(args[1:])
 		case "stop":
 			s.handleStop()
+		case "ponderhit":
+			s.handlePonderHit()
 		case "isready":
 			s.handleIsReady()
+		case "setoption":
+			s.handleSetOption(args[1:])
 		case "perft":
 			s.handlePerft(args[1:])
+		case "eval":
+			s.handleEval()
 		case "cpuprofile":
 			s.handleCPUProfile(args[1:])
 		case "debug":
@@ -121,13 +128,47 @@ func (s *UCIServer) error(msg string, args ...any) {
 func (s *UCIServer) handleUCI() {
 	s.WriteString("id name %s", BotName)
 	s.WriteString("id author %s", Author)
+	for _, opt := range s.engine.Options() {
+		switch opt.Type {
+		case "spin":
+			s.WriteString("option name %s type spin default %s min %d max %d", opt.Name, opt.Default, opt.Min, opt.Max)
+		default:
+			s.WriteString("option name %s type %s default %s", opt.Name, opt.Type, opt.Default)
+		}
+	}
 	s.WriteString("uciok")
 }
 
+// handleSetOption responds to the "setoption" command, which changes one of
+// the engine parameters advertised by handleUCI. The expected syntax is
+// "setoption name <id> [value <x>]".
+func (s *UCIServer) handleSetOption(args []string) {
+	var name, value string
+
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "name":
+			for i++; i < len(args) && args[i] != "value"; i++ {
+				name = strings.TrimSpace(name + " " + args[i])
+			}
+			i--
+		case "value":
+			value = strings.Join(args[i+1:], " ")
+			i = len(args)
+		}
+	}
+
+	if err := s.engine.SetOption(name, value); err != nil {
+		s.error("%s", err)
+	}
+}
+
 // handleUCINewGame responds to the "ucinewgame" command by resetting the
-// board to the starting position.
+// board to the starting position and clearing the transposition table.
 func (s *UCIServer) handleUCINewGame() {
-	s.resetPosition()
+	if err := s.engine.NewGame(); err != nil {
+		s.error("%s", err)
+	}
 }
 
 // handlePosition responds to the "position" command, which sets up the board
@@ -139,118 +180,129 @@ func (s *UCIServer) handlePosition(args []string) {
 		return
 	}
 
+	var fen string
+	var i int
+
 	switch args[0] {
 	case "startpos":
-		s.resetPosition()
-		if len(args) > 1 {
-			args = args[1:]
-		} else {
-			args = nil
-		}
+		i = 1
 	case "fen":
-		var i int
 		for i = 1; i < len(args); i++ {
 			if args[i] == "moves" {
 				break
 			}
 		}
-
-		fen := strings.Join(args[1:i], " ")
-		pos, err := chester.ParseFEN(fen)
-		if err != nil {
-			s.error("error parsing fen: %s", err)
-			return
-		}
-		s.pos = pos
-		args = args[i:]
+		fen = strings.Join(args[1:i], " ")
 	default:
-		s.error("unknown position argument: %s", args[1])
+		s.error("unknown position argument: %s", args[0])
+		return
 	}
 
-	s.debug("args: %v", args)
-
-	if len(args) > 0 && args[0] == "moves" {
-		for _, m := range args[1:] {
-			m = strings.TrimSpace(m)
-			if m != "" {
-				move, err := chester.ParseMove(m, s.pos)
-				if err != nil {
-					s.error("error parsing move: %s", err)
-					return
-				}
-				s.pos.Do(move)
-				s.debug("position: %s", s.pos.String())
+	var moves []string
+	if i < len(args) && args[i] == "moves" {
+		for _, m := range args[i+1:] {
+			if m = strings.TrimSpace(m); m != "" {
+				moves = append(moves, m)
 			}
 		}
 	}
+
+	s.debug("fen: %s moves: %v", fen, moves)
+
+	if err := s.engine.SetPosition(fen, moves); err != nil {
+		s.error("error setting position: %s", err)
+		return
+	}
+	s.debug("position: %s", s.engine.Position().String())
 }
 
 // handleGo responds to the "go" command, which initiates a search for the
 // best move. It parses search constraints like time, depth, and node limits
-// from the provided arguments.
+// from the provided arguments; without any the search is infinite.
 func (s *UCIServer) handleGo(args []string) {
-	if len(args) < 1 {
-		s.error("go command requires at least 2 arguments")
-		return
+	limits := chester.Limits{
+		OnCurrMove: func(depth int, m chester.Move, number int) {
+			s.WriteString("info depth %d currmove %s currmovenumber %d", depth, m, number)
+		},
 	}
 
-	opts := &chester.SearchOptions{
-		MaxDepth:           100,
-		MaxNodes:           math.MaxInt64,
-		TranspositionTable: s.tt,
-	}
-
-	var wtime, btime, winc, binc, movestogo, movetime int64
+	pos := s.engine.Position()
 
 	// parse go arguments
 	for i := 0; i < len(args); i++ {
 		switch args[i] {
 		case "depth":
 			i++
-			fmt.Sscanf(args[i], "%d", &opts.MaxDepth)
+			fmt.Sscanf(args[i], "%d", &limits.Depth)
 		case "nodes":
 			i++
-			fmt.Sscanf(args[i], "%d", &opts.MaxNodes)
+			fmt.Sscanf(args[i], "%d", &limits.Nodes)
 		case "movetime":
 			i++
-			fmt.Sscanf(args[i], "%d", &movetime)
-			opts.MaxTime = time.Duration(movetime) * time.Millisecond
+			limits.MoveTime = parseMillis(args[i])
 		case "wtime":
 			i++
-			fmt.Sscanf(args[i], "%d", &wtime)
+			limits.WhiteTime = parseMillis(args[i])
 		case "btime":
 			i++
-			fmt.Sscanf(args[i], "%d", &btime)
+			limits.BlackTime = parseMillis(args[i])
 		case "winc":
 			i++
-			fmt.Sscanf(args[i], "%d", &winc)
+			limits.WhiteInc = parseMillis(args[i])
 		case "binc":
 			i++
-			fmt.Sscanf(args[i], "%d", &binc)
+			limits.BlackInc = parseMillis(args[i])
 		case "movestogo":
 			i++
-			fmt.Sscanf(args[i], "%d", &movestogo)
+			fmt.Sscanf(args[i], "%d", &limits.MovesToGo)
+		case "searchmoves":
+			for i+1 < len(args) {
+				m, err := chester.ParseMove(args[i+1], pos)
+				if err != nil {
+					break
+				}
+				limits.SearchMoves = append(limits.SearchMoves, m)
+				i++
+			}
 		case "infinite":
-			opts.MaxTime = 0
-			opts.MaxDepth = 100
+			// searches until stopped, keeping the moves to search and
+			// ponder
+			limits.Depth, limits.Nodes, limits.MoveTime = 0, 0, 0
+			limits.WhiteTime, limits.BlackTime, limits.WhiteInc, limits.BlackInc = 0, 0, 0, 0
+			limits.MovesToGo = 0
+		case "ponder":
+			limits.Ponder = true
 		}
 	}
 
-	if opts.MaxTime == 0 && (wtime > 0 || btime > 0) {
-		opts.MaxTime = calculateTimeLimit(s.pos.Active(), wtime, btime, winc, binc, movestogo)
-	}
-
+	s.search.Add(1)
 	go func() {
-		pos := *s.pos
-		ch, stopFunc := chester.SearchBestMove(&pos, opts)
-		s.stopFunc = stopFunc
-		for e := range ch {
-			s.info("depth %d score cp %d pv %s", e.Depth, e.Score, e.Best)
-			s.bestMove = e.Best.String()
+		defer s.search.Done()
+
+		// infinite and ponder searches hold the bestmove until stop or
+		// ponderhit
+		best, err := s.engine.Go(context.Background(), limits, func(e chester.Evaluation) {
+			s.WriteString("info depth %d seldepth %d multipv %d score %s nodes %d nps %d hashfull %d time %d pv %s",
+				e.Depth, e.SelDepth, e.MultiPV, formatScore(e.Score), e.Nodes, e.NPS, e.Hashfull, e.Time.Milliseconds(), formatPV(e.PV))
+			if e.MultiPV == 1 {
+				s.info("qnodes %d tthits %.1f%%", e.QNodes, e.TTHitRate*100)
+			}
+		})
+		if errors.Is(err, chester.ErrSearching) {
+			s.error("%s", err)
+			return
 		}
 
-		s.stopFunc = nil
-		s.WriteString("bestmove %s", s.bestMove)
+		switch {
+		case err != nil:
+			// the GUI always expects a bestmove, even without moves
+			s.error("%s", err)
+			s.WriteString("bestmove 0000")
+		case len(best.PV) > 1:
+			s.WriteString("bestmove %s ponder %s", best.Best, best.PV[1])
+		default:
+			s.WriteString("bestmove %s", best.Best)
+		}
 	}()
 }
 
@@ -261,12 +313,29 @@ func (s *UCIServer) handleIsReady() {
 }
 
 // handleStop responds to the "stop" command by immediately aborting any
-// ongoing search.
+// ongoing search. It returns once the bestmove has been sent, so a "go"
+// right after it starts a new search.
 func (s *UCIServer) handleStop() {
-	if s.stopFunc != nil {
-		s.stopFunc()
-		s.stopFunc = nil
+	s.engine.Stop()
+	s.search.Wait()
+}
+
+// handlePonderHit responds to the "ponderhit" command, sent when the
+// opponent played the expected move. The ongoing ponder search carries on
+// as a regular timed search.
+func (s *UCIServer) handlePonderHit() {
+	s.engine.Ponderhit()
+}
+
+// handleEval handles the "eval" command, which prints the breakdown of the
+// evaluation the engine searches the current position with.
+func (s *UCIServer) handleEval() {
+	trace, err := s.engine.TraceEval()
+	if err != nil {
+		s.error("%s", err)
+		return
 	}
+	s.Write([]byte(trace.String()))
 }
 
 // handlePerft handles the "perft" command, which runs a performance test
@@ -286,8 +355,7 @@ func (s *UCIServer) handlePerft(args []string) {
 	go func() {
 		nodes := 0
 		start := time.Now()
-		pos := *s.pos
-		ch := chester.Perft(&pos, depth)
+		ch := chester.Perft(s.engine.Position(), depth)
 		for m := range ch {
 			nodes += m.Count
 			s.WriteString("%s: %d", m.Move, m.Count)
@@ -342,37 +410,30 @@ func (s *UCIServer) handleDebug(args []string) {
 	}
 }
 
-// resetPosition resets the board to the standard starting FEN.
-func (s *UCIServer) resetPosition() {
-	pos, err := chester.ParseFEN(chester.DefaultFEN)
-	if err != nil {
-		s.error("error parsing fen: %s", err)
-	}
-	s.pos = pos
+// parseMillis parses a duration in milliseconds.
+func parseMillis(s string) time.Duration {
+	var ms int64
+	fmt.Sscanf(s, "%d", &ms)
+	return time.Duration(ms) * time.Millisecond
 }
 
-// calculateTimeLimit determines a reasonable maximum duration for a move
-// based on remaining time, increments, and moves to go.
-func calculateTimeLimit(color chester.Color, wtime, btime, winc, binc, movestogo int64) time.Duration {
-	var timeLeft, inc int64
-
-	if color == chester.White {
-		timeLeft, inc = wtime, winc
-	} else {
-		timeLeft, inc = btime, binc
-	}
-
-	if movestogo <= 0 {
-		movestogo = 30
+// formatScore returns the UCI representation of a score, either
+// "cp <centipawns>" or "mate <moves>".
+func formatScore(score chester.Score) string {
+	if score.IsMate() {
+		return fmt.Sprintf("mate %d", score.MateIn())
 	}
+	return fmt.Sprintf("cp %d", score.Centipawns())
+}
 
-	targetMs := (timeLeft / movestogo) + int64(float64(inc)*0.8)
-
-	if targetMs > timeLeft/2 {
-		targetMs = timeLeft / 2
+// formatPV returns the UCI representation of a principal variation, the
+// moves separated by spaces.
+func formatPV(pv []chester.Move) string {
+	moves := make([]string, len(pv))
+	for i, m := range pv {
+		moves[i] = m.String()
 	}
-
-	return time.Duration(targetMs) * time.Millisecond
+	return strings.Join(moves, " ")
 }
 
 // formatNPS returns a human-readable string representation of nodes per second.
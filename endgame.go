@@ -0,0 +1,167 @@
+package chester
+
+import "strings"
+
+// knownWin is the base score of an endgame known to be won. It is well
+// above any material advantage and below the mate scores, so the search
+// keeps converting the win.
+const knownWin = 10_000
+
+// endgameFunc evaluates an endgame from the point of view of strong, the
+// side with more material.
+type endgameFunc func(p *Position, strong Color) int
+
+// endgame is a specialized evaluation registered for a material
+// signature.
+type endgame struct {
+	fn     endgameFunc
+	strong Color
+}
+
+// endgameEvals are the specialized endgame evaluations, keyed by material
+// hash. See [MaterialEntry.Endgame].
+var endgameEvals = map[uint64]endgame{}
+
+func init() {
+	for code, fn := range map[string]endgameFunc{
+		"KQK":  evalKXK,
+		"KRK":  evalKXK,
+		"KBNK": evalKBNK,
+		"KPK":  evalKPK,
+		"KRKP": evalKRKP,
+		"KNNK": evalDraw,
+		"KNK":  evalDraw,
+		"KBK":  evalDraw,
+	} {
+		for strong := range Color(2) {
+			endgameEvals[endgameKey(code, strong)] = endgame{fn, strong}
+		}
+	}
+}
+
+// endgameKey returns the material hash of the endgame described by code,
+// the pieces of the strong side followed by those of the weak one, each
+// starting with its king, like "KRKP".
+func endgameKey(code string, strong Color) uint64 {
+	i := strings.LastIndexByte(code, 'K')
+	sides := [Color(2)]string{code[:i], code[i:]}
+	if strong == Black {
+		sides[White], sides[Black] = sides[Black], sides[White]
+	}
+
+	var hash uint64
+	for color, pieces := range sides {
+		var count [Piece(6)]int
+		for _, c := range pieces {
+			piece := Piece(strings.IndexRune("PNBRQK", c))
+			hash ^= polyglotTable.Pieces[color][piece][count[piece]]
+			count[piece]++
+		}
+	}
+	return hash
+}
+
+// kingSquare returns the square of the king of color.
+func kingSquare(p *Position, color Color) Square {
+	sq, _ := (p.pieces[King] & p.allPieces[color]).PopLSB()
+	return sq
+}
+
+// pushToEdge is a bonus for driving a king towards the edge of the board,
+// highest in the corners.
+func pushToEdge(sq Square) int {
+	rank, file := sq.RankAndFile()
+	r, f := int(min(rank, 7-rank)), int(min(file, 7-file))
+	return 90 - 20*min(r, f) - 10*max(r, f)
+}
+
+// pushClose is a bonus for bringing two kings close together.
+func pushClose(a, b Square) int {
+	return 140 - 20*squareDistance(a, b)
+}
+
+// evalKXK evaluates a queen or a rook against a bare king: the defending
+// king is driven to the edge and the attacking king brought close to it.
+func evalKXK(p *Position, strong Color) int {
+	strongKing, weakKing := kingSquare(p, strong), kingSquare(p, strong^1)
+
+	score := knownWin + pushToEdge(weakKing) + pushClose(strongKing, weakKing)
+	for piece := Knight; piece <= Queen; piece++ {
+		score += (p.pieces[piece] & p.allPieces[strong]).OnesCount() * egValue[piece]
+	}
+	return score
+}
+
+// evalKBNK evaluates bishop and knight against a bare king. Mate can only
+// be forced in a corner of the color of the bishop, so the defending king
+// is driven there.
+func evalKBNK(p *Position, strong Color) int {
+	strongKing, weakKing := kingSquare(p, strong), kingSquare(p, strong^1)
+	bishop, _ := (p.pieces[Bishop] & p.allPieces[strong]).PopLSB()
+
+	// distance from the long diagonal of the other color, the highest in
+	// the corners of the bishop color
+	rank, file := weakKing.RankAndFile()
+	if isLightSquare(bishop) {
+		file = 7 - file
+	}
+	corner := int(7 - rank - file)
+	corner = max(corner, -corner)
+
+	return knownWin + egValue[Bishop] + egValue[Knight] + 420*corner + pushClose(strongKing, weakKing)
+}
+
+// evalKPK evaluates king and pawn against king with the KPK bitbase.
+// Won positions score higher as the pawn advances and the attacking king
+// gets close to the promotion square.
+func evalKPK(p *Position, strong Color) int {
+	if !ProbeKPK(p) {
+		return 0
+	}
+
+	pawn, _ := (p.pieces[Pawn] & p.allPieces[strong]).PopLSB()
+	queening := SquareFromRankAndFile(7, pawn.File())
+	if strong == Black {
+		queening = SquareFromRankAndFile(0, pawn.File())
+	}
+
+	return knownWin + egValue[Pawn] + 20*relativeRank(strong, pawn) - 5*squareDistance(kingSquare(p, strong), queening)
+}
+
+// evalKRKP evaluates a rook against a pawn. The rook wins when its king
+// stops the pawn or the defending king is too far from it, otherwise the
+// score depends on the race between the kings.
+func evalKRKP(p *Position, strong Color) int {
+	weak := strong ^ 1
+	strongKing, weakKing := kingSquare(p, strong), kingSquare(p, weak)
+	rook, _ := (p.pieces[Rook] & p.allPieces[strong]).PopLSB()
+	pawn, _ := (p.pieces[Pawn] & p.allPieces[weak]).PopLSB()
+
+	queening, push := SquareFromRankAndFile(7, pawn.File()), pawn-8
+	if weak == Black {
+		queening, push = SquareFromRankAndFile(0, pawn.File()), pawn+8
+	}
+
+	tempo := 0
+	if p.active == weak {
+		tempo = 1
+	}
+
+	switch {
+	case forwardFileMask[weak][pawn]&NewBitboardFromSquare(strongKing) != 0:
+		return egValue[Rook] - squareDistance(strongKing, pawn)
+	case squareDistance(weakKing, pawn) >= 3+tempo && squareDistance(weakKing, rook) >= 3:
+		return egValue[Rook] - squareDistance(strongKing, pawn)
+	case relativeRank(strong, weakKing) <= 2 && squareDistance(weakKing, pawn) == 1 &&
+		relativeRank(strong, strongKing) >= 3 && squareDistance(strongKing, pawn) > 3-tempo:
+		return 80 - 8*squareDistance(strongKing, pawn)
+	default:
+		return 200 - 8*(squareDistance(strongKing, push)-squareDistance(weakKing, push)-squareDistance(pawn, queening))
+	}
+}
+
+// evalDraw evaluates endings that can't be won, like two knights against a
+// bare king, as a draw.
+func evalDraw(p *Position, strong Color) int {
+	return 0
+}
@@ -0,0 +1,134 @@
+package chester_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bluescreen10/chester"
+)
+
+func TestMaterialTable_Endgame(t *testing.T) {
+	tests := []struct {
+		name string
+		fen  string
+		ok   bool
+		win  bool
+	}{
+		{"KQK", "8/8/8/4k3/8/8/8/3QK3 w - - 0 1", true, true},
+		{"KQK black", "3qk3/8/8/8/4K3/8/8/8 b - - 0 1", true, true},
+		{"KQK defender to move", "8/8/8/4k3/8/8/8/3QK3 b - - 0 1", true, false},
+		{"KRK", "8/8/8/4k3/8/8/8/3RK3 w - - 0 1", true, true},
+		{"KBNK", "8/8/8/4k3/8/8/8/2BNK3 w - - 0 1", true, true},
+		{"KRKP", "8/8/8/4k3/8/8/1p6/3RK3 w - - 0 1", true, true},
+		{"KPK", "8/8/8/8/8/8/P6k/K7 w - - 0 1", true, true},
+		{"KPK draw", "8/8/8/4k3/8/8/1P6/4K3 w - - 0 1", true, false},
+		{"KNNK", "8/8/8/4k3/8/8/8/2NNK3 w - - 0 1", true, false},
+		{"KNK", "8/8/8/4k3/8/8/8/3NK3 b - - 0 1", true, false},
+		{"KBK", "3bk3/8/8/8/4K3/8/8/8 w - - 0 1", true, false},
+		{"KQKR", "8/8/8/3rk3/8/8/8/3QK3 w - - 0 1", false, false},
+	}
+
+	table := chester.NewMaterialTable(64 * 1024)
+
+	for _, test := range tests {
+		p, err := chester.ParseFEN(test.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		entry := table.Probe(p)
+		score, ok := entry.Endgame(p)
+		if ok != test.ok {
+			t.Errorf("%s: got recognized %v, want %v", test.name, ok, test.ok)
+			continue
+		}
+		if ok && (score > 0) != test.win {
+			t.Errorf("%s: got score %d, want win %v", test.name, score, test.win)
+		}
+	}
+}
+
+func TestEvalPesto_Endgames(t *testing.T) {
+	eval := func(fen string) int {
+		p, err := chester.ParseFEN(fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return chester.EvalPesto(p)
+	}
+
+	// the defending king is driven to the edge
+	if edge, center := eval("4k3/8/4K3/8/8/8/8/3Q4 w - - 0 1"), eval("8/8/8/4k3/8/4K3/8/3Q4 w - - 0 1"); edge <= center {
+		t.Errorf("KQK: got %d on the edge, %d in the center", edge, center)
+	}
+
+	// and to a corner of the color of the bishop with bishop and knight
+	if right, wrong := eval("k7/8/2K5/8/8/8/8/3BN3 w - - 0 1"), eval("7k/8/5K2/8/8/8/8/3BN3 w - - 0 1"); right <= wrong {
+		t.Errorf("KBNK: got %d in the right corner, %d in the wrong one", right, wrong)
+	}
+
+	// two knights can't force mate, nor can a lone minor piece
+	for _, fen := range []string{
+		"8/8/8/4k3/8/8/8/2NNK3 w - - 0 1",
+		"8/8/8/4k3/8/8/8/2NNK3 b - - 0 1",
+		"8/8/8/4k3/8/8/8/3NK3 w - - 0 1",
+		"3bk3/8/8/8/4K3/8/8/8 b - - 0 1",
+	} {
+		if score := eval(fen); score != 0 {
+			t.Errorf("%s: got %d, want a draw", fen, score)
+		}
+	}
+
+	// the rook wins when its king is in front of the pawn and it is a
+	// fight when the pawn is supported and far advanced
+	won, fight := eval("8/8/8/8/8/1K6/1p6/3R3k w - - 0 1"), eval("8/8/8/8/K7/8/1pk5/3R4 w - - 0 1")
+	if won <= fight {
+		t.Errorf("KRKP: got %d with the king in front, %d for the race", won, fight)
+	}
+}
+
+func TestSearch_ConvertEndgame(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping endgame conversion in short mode")
+	}
+
+	tests := []struct {
+		fen   string
+		depth int
+	}{
+		{"8/8/8/4k3/8/8/8/3QK3 w - - 0 1", 6},
+		{"8/8/8/4k3/8/8/8/R3K3 w - - 0 1", 6},
+		{"8/8/8/4k3/8/8/8/2BNK3 w - - 0 1", 10},
+	}
+
+	for _, test := range tests {
+		p, _ := chester.ParseFEN(test.fen)
+		tt := chester.NewTranspositionTable(16 * 1024 * 1024)
+
+		var history []uint64
+		mated := false
+		for range 100 {
+			moves, inCheck := chester.LegalMoves(nil, p)
+			if len(moves) == 0 {
+				mated = inCheck
+				break
+			}
+
+			best, err := chester.Search(context.Background(), p, chester.SearchOptions{
+				MaxDepth:           test.depth,
+				TranspositionTable: tt,
+				History:            history,
+			}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			history = append(history, p.Hash())
+			p.Do(best.Best)
+		}
+
+		if !mated {
+			t.Errorf("%s: didn't mate, ended at %s", test.fen, p.FEN())
+		}
+	}
+}
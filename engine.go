@@ -0,0 +1,429 @@
+package chester
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxThreads is the maximum number of search threads accepted by the
+	// Threads option.
+	maxThreads = 256
+
+	// defaultHashMB and maxHashMB are the default and maximum size of the
+	// transposition table in megabytes.
+	defaultHashMB = 64
+	maxHashMB     = 32 * 1024
+
+	// maxContempt is the maximum absolute value, in centipawns, accepted
+	// by the Contempt option.
+	maxContempt = 100
+
+	// maxMultiPV is the maximum number of lines accepted by the MultiPV
+	// option.
+	maxMultiPV = 256
+
+	// defaultMoveOverheadMs and maxMoveOverheadMs are the default and
+	// maximum time, in milliseconds, kept in reserve for every move to
+	// compensate for communication lag.
+	defaultMoveOverheadMs = 50
+	maxMoveOverheadMs     = 5000
+)
+
+// ErrSearching is returned by the [Engine] methods that can't run while a
+// search is in progress.
+var ErrSearching = errors.New("search in progress")
+
+// ErrNoTrace is returned by [Engine.TraceEval] when the engine evaluates
+// with a network, whose evaluation can't be broken down into terms.
+var ErrNoTrace = errors.New("evaluation can't be traced")
+
+// EngineOption describes a setting accepted by [Engine.SetOption], in the
+// terms of the UCI protocol.
+type EngineOption struct {
+	// Name of the option, matched case-insensitively.
+	Name string
+
+	// Type is either "spin", "check" or "string".
+	Type string
+
+	// Default is the initial value of the option.
+	Default string
+
+	// Min and Max are the bounds of spin options.
+	Min, Max int
+}
+
+// engineOptions lists the options supported by the engine.
+var engineOptions = []EngineOption{
+	{Name: "Hash", Type: "spin", Default: strconv.Itoa(defaultHashMB), Min: 1, Max: maxHashMB},
+	{Name: "Threads", Type: "spin", Default: "1", Min: 1, Max: maxThreads},
+	{Name: "Contempt", Type: "spin", Default: "0", Min: -maxContempt, Max: maxContempt},
+	{Name: "Ponder", Type: "check", Default: "false"},
+	{Name: "MultiPV", Type: "spin", Default: "1", Min: 1, Max: maxMultiPV},
+	{Name: "Move Overhead", Type: "spin", Default: strconv.Itoa(defaultMoveOverheadMs), Min: 0, Max: maxMoveOverheadMs},
+	{Name: "TablebasePath", Type: "string", Default: "<empty>"},
+	{Name: "EvalFile", Type: "string", Default: "<empty>"},
+	{Name: "EvalParams", Type: "string", Default: "<empty>"},
+}
+
+// Limits constrains a search started with [Engine.Go]. Without a depth,
+// node or time limit the search is infinite: it runs until stopped, and
+// the result is held until then even if the search ends earlier.
+type Limits struct {
+	// Depth is the maximum number of plies to search.
+	Depth int
+
+	// Nodes is the maximum number of nodes to search.
+	Nodes int64
+
+	// MoveTime is the exact time to search.
+	MoveTime time.Duration
+
+	// WhiteTime, BlackTime, WhiteInc and BlackInc describe the clocks. The
+	// engine manages its own time when the clock of the side to move is
+	// set.
+	WhiteTime, BlackTime time.Duration
+	WhiteInc, BlackInc   time.Duration
+
+	// MovesToGo is the number of moves until the next time control.
+	MovesToGo int
+
+	// Ponder starts the search in pondering mode, see [Engine.Ponderhit].
+	Ponder bool
+
+	// SearchMoves restricts the search to these root moves.
+	SearchMoves []Move
+
+	// OnCurrMove, if not nil, receives the root move being searched. See
+	// [SearchOptions.OnCurrMove].
+	OnCurrMove func(depth int, m Move, number int)
+}
+
+// Engine bundles a game position, a transposition table and the engine
+// settings, and runs searches on them. It is the building block for
+// protocol servers and bots embedding chester.
+//
+// All methods are safe for concurrent use. Only one search runs at a time.
+type Engine struct {
+	mutex        sync.Mutex
+	pos          *Position
+	history      []uint64
+	tt           *TranspositionTable
+	threads      int
+	contempt     int
+	multiPV      int
+	moveOverhead time.Duration
+	tablebase    *Tablebase
+	network      *Network
+	evalParams   *EvalParams
+
+	// searching is set while a search runs. stop aborts it, done is
+	// closed once it has returned and ponderHit, when not nil, is closed
+	// on ponder hit.
+	searching bool
+	stop      context.CancelFunc
+	done      chan struct{}
+	ponderHit chan struct{}
+}
+
+// NewEngine returns an engine set up at the starting position with the
+// default options.
+func NewEngine() *Engine {
+	pos, _ := ParseFEN(DefaultFEN)
+	return &Engine{
+		pos:          pos,
+		tt:           NewTranspositionTable(defaultHashMB * 1024 * 1024),
+		threads:      1,
+		multiPV:      1,
+		moveOverhead: defaultMoveOverheadMs * time.Millisecond,
+	}
+}
+
+// Options returns the options supported by [Engine.SetOption].
+func (e *Engine) Options() []EngineOption {
+	return engineOptions
+}
+
+// SetOption changes the engine option name to value. It returns an error
+// if the option is unknown or the value is invalid. Options take effect on
+// the next search.
+func (e *Engine) SetOption(name, value string) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	spin := func(opt EngineOption) (int, error) {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < opt.Min || n > opt.Max {
+			return 0, fmt.Errorf("invalid %s value: %s", opt.Name, value)
+		}
+		return n, nil
+	}
+
+	for _, opt := range engineOptions {
+		if !strings.EqualFold(opt.Name, name) {
+			continue
+		}
+
+		if opt.Type == "check" && value != "true" && value != "false" {
+			return fmt.Errorf("invalid %s value: %s", opt.Name, value)
+		}
+
+		var n int
+		if opt.Type == "spin" {
+			var err error
+			if n, err = spin(opt); err != nil {
+				return err
+			}
+		}
+
+		switch opt.Name {
+		case "Hash":
+			if e.searching {
+				return ErrSearching
+			}
+			e.tt.Resize(uint64(n) * 1024 * 1024)
+		case "Threads":
+			e.threads = n
+		case "Contempt":
+			e.contempt = n
+		case "MultiPV":
+			e.multiPV = n
+		case "Move Overhead":
+			e.moveOverhead = time.Duration(n) * time.Millisecond
+		case "TablebasePath":
+			if e.searching {
+				return ErrSearching
+			}
+			if value == "" || value == "<empty>" {
+				e.tablebase = nil
+				break
+			}
+			tb := NewTablebase()
+			if err := tb.Load(value); err != nil {
+				return err
+			}
+			e.tablebase = tb
+		case "EvalFile":
+			if e.searching {
+				return ErrSearching
+			}
+			if value == "" || value == "<empty>" {
+				e.network = nil
+				break
+			}
+			net, err := LoadNetwork(value)
+			if err != nil {
+				return err
+			}
+			e.network = net
+		case "EvalParams":
+			if e.searching {
+				return ErrSearching
+			}
+			if value == "" || value == "<empty>" {
+				e.evalParams = nil
+				break
+			}
+			params, err := LoadEvalParams(value)
+			if err != nil {
+				return err
+			}
+			e.evalParams = params
+		case "Ponder":
+			// the caller decides when to ponder, the option only
+			// announces it may do so
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown option: %s", name)
+}
+
+// NewGame resets the engine to the starting position and clears the
+// transposition table.
+func (e *Engine) NewGame() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.searching {
+		return ErrSearching
+	}
+
+	e.pos, _ = ParseFEN(DefaultFEN)
+	e.history = e.history[:0]
+	e.tt.Clear()
+	return nil
+}
+
+// SetPosition sets up the position given by fen, or the starting position
+// if fen is empty, and plays moves, in pure algebraic coordinate notation,
+// from it. The engine position is left unchanged on error.
+func (e *Engine) SetPosition(fen string, moves []string) error {
+	if fen == "" {
+		fen = DefaultFEN
+	}
+
+	pos, err := ParseFEN(fen)
+	if err != nil {
+		return err
+	}
+
+	var history []uint64
+	for _, s := range moves {
+		m, err := ParseMove(s, pos)
+		if err != nil {
+			return err
+		}
+		history = append(history, pos.hash)
+		pos.Do(m)
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.pos = pos
+	e.history = history
+	return nil
+}
+
+// Position returns a copy of the current position.
+func (e *Engine) Position() *Position {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	pos := e.pos.Copy()
+	return &pos
+}
+
+// TraceEval returns the breakdown of the evaluation the engine searches the
+// current position with, see [TracePesto]. It returns [ErrNoTrace] when a
+// network is loaded with the EvalFile option.
+func (e *Engine) TraceEval() (EvalTrace, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.network != nil {
+		return EvalTrace{}, ErrNoTrace
+	}
+	pos := e.pos.Copy()
+	return TracePesto(&pos, e.evalParams), nil
+}
+
+// Go searches the current position within limits and returns the best
+// line found. Every intermediate result is passed to onInfo, if not nil.
+// The search ends when a limit is reached, when [Engine.Stop] is called or
+// when ctx is done; infinite and ponder searches only return once stopped,
+// or after the ponder hit. It returns [ErrSearching] if a search is
+// already running, otherwise the errors of [Search].
+func (e *Engine) Go(ctx context.Context, limits Limits, onInfo func(Evaluation)) (Evaluation, error) {
+	e.mutex.Lock()
+	if e.searching {
+		e.mutex.Unlock()
+		return Evaluation{}, ErrSearching
+	}
+
+	pos := e.pos.Copy()
+	opts := e.searchOptions(limits)
+	if limits.Ponder {
+		e.ponderHit = make(chan struct{})
+		opts.PonderHit = e.ponderHit
+	}
+
+	infinite := opts.MaxDepth == 0 && opts.MaxNodes == 0 && opts.MaxTime == 0
+
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	done := make(chan struct{})
+	defer close(done)
+
+	e.searching = true
+	e.stop = stop
+	e.done = done
+	e.mutex.Unlock()
+
+	best, err := Search(ctx, &pos, opts, onInfo)
+	if infinite && err == nil {
+		// the result of an infinite search is only final once stopped
+		<-ctx.Done()
+	}
+
+	e.mutex.Lock()
+	e.searching = false
+	e.stop = nil
+	e.done = nil
+	e.ponderHit = nil
+	e.mutex.Unlock()
+
+	return best, err
+}
+
+// searchOptions translates limits into the options of a search of the
+// current position.
+func (e *Engine) searchOptions(limits Limits) SearchOptions {
+	opts := SearchOptions{
+		MaxDepth:           limits.Depth,
+		MaxNodes:           limits.Nodes,
+		MaxTime:            limits.MoveTime,
+		Moves:              limits.SearchMoves,
+		TranspositionTable: e.tt,
+		Tablebase:          e.tablebase,
+		EvalParams:         e.evalParams,
+		History:            append([]uint64(nil), e.history...),
+		Contempt:           e.contempt,
+		MultiPV:            e.multiPV,
+		Threads:            e.threads,
+		OnCurrMove:         limits.OnCurrMove,
+	}
+	if e.network != nil {
+		opts.Evaluator = NewNNUEEvaluator(e.network)
+	}
+
+	clock := TimeControl{
+		Time:         limits.WhiteTime,
+		Increment:    limits.WhiteInc,
+		MovesToGo:    limits.MovesToGo,
+		MoveOverhead: e.moveOverhead,
+	}
+	if e.pos.active == Black {
+		clock.Time, clock.Increment = limits.BlackTime, limits.BlackInc
+	}
+
+	if opts.MaxTime == 0 && clock.Time > 0 {
+		opts.SoftTime, opts.MaxTime = clock.Limits()
+	}
+
+	return opts
+}
+
+// Stop aborts the running search, if any, and waits for [Engine.Go] to
+// return the best move found so far, so a new search can start right
+// away. It must not be called from the onInfo function of the search.
+func (e *Engine) Stop() {
+	e.mutex.Lock()
+	stop, done := e.stop, e.done
+	e.mutex.Unlock()
+
+	if stop != nil {
+		stop()
+		<-done
+	}
+}
+
+// Ponderhit turns the running ponder search into a regular search, the
+// time limits start counting from now.
+func (e *Engine) Ponderhit() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.ponderHit != nil {
+		close(e.ponderHit)
+		e.ponderHit = nil
+	}
+}
@@ -0,0 +1,241 @@
+package chester_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bluescreen10/chester"
+)
+
+func TestEngineSetPosition(t *testing.T) {
+	tests := []struct {
+		name    string
+		fen     string
+		moves   []string
+		wantFEN string
+		wantErr bool
+	}{
+		{
+			name:    "start position",
+			wantFEN: chester.DefaultFEN,
+		},
+		{
+			name:    "start position with moves",
+			moves:   []string{"e2e4", "e7e5"},
+			wantFEN: "rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR w KQkq e6 0 2",
+		},
+		{
+			name:    "fen",
+			fen:     "4k3/8/8/8/8/8/8/4K2R w K - 0 1",
+			moves:   []string{"e1g1"},
+			wantFEN: "4k3/8/8/8/8/8/8/5RK1 b - - 1 1",
+		},
+		{
+			name:    "invalid fen",
+			fen:     "invalid",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := chester.NewEngine()
+			err := e.SetPosition(test.fen, test.moves)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %t", err, test.wantErr)
+			}
+
+			if err == nil && e.Position().FEN() != test.wantFEN {
+				t.Errorf("got position %s, want %s", e.Position().FEN(), test.wantFEN)
+			}
+		})
+	}
+}
+
+func TestEngineSetOption(t *testing.T) {
+	params := filepath.Join(t.TempDir(), "params.json")
+	f, err := os.Create(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chester.DefaultEvalParams().WriteTo(f)
+	f.Close()
+
+	tests := []struct {
+		name    string
+		value   string
+		wantErr bool
+	}{
+		{name: "Hash", value: "16"},
+		{name: "threads", value: "2"},
+		{name: "Contempt", value: "-20"},
+		{name: "MultiPV", value: "3"},
+		{name: "Move Overhead", value: "100"},
+		{name: "Ponder", value: "true"},
+		{name: "TablebasePath", value: t.TempDir()},
+		{name: "TablebasePath", value: "<empty>"},
+		{name: "TablebasePath", value: filepath.Join(t.TempDir(), "missing"), wantErr: true},
+		{name: "EvalFile", value: "testdata/tiny.nnue"},
+		{name: "EvalFile", value: "<empty>"},
+		{name: "EvalFile", value: "engine_test.go", wantErr: true},
+		{name: "EvalParams", value: params},
+		{name: "EvalParams", value: "<empty>"},
+		{name: "EvalParams", value: "engine_test.go", wantErr: true},
+		{name: "Hash", value: "0", wantErr: true},
+		{name: "Threads", value: "many", wantErr: true},
+		{name: "Ponder", value: "maybe", wantErr: true},
+		{name: "Unknown", value: "1", wantErr: true},
+	}
+
+	e := chester.NewEngine()
+	for _, test := range tests {
+		err := e.SetOption(test.name, test.value)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s=%s: got error %v, want error %t", test.name, test.value, err, test.wantErr)
+		}
+	}
+}
+
+func TestEngineTraceEval(t *testing.T) {
+	e := chester.NewEngine()
+	e.SetPosition("r2q1rk1/ppp2ppp/2np1n2/2b1p1B1/2B1P1b1/2NP1N2/PPP2PPP/R2Q1RK1 b - - 0 8", nil)
+
+	trace, err := e.TraceEval()
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if want := chester.EvalPesto(e.Position()); trace.Score != want {
+		t.Errorf("got score %d, want %d", trace.Score, want)
+	}
+
+	e.SetOption("EvalFile", "testdata/tiny.nnue")
+	if _, err := e.TraceEval(); !errors.Is(err, chester.ErrNoTrace) {
+		t.Errorf("got error %v, want %v", err, chester.ErrNoTrace)
+	}
+}
+
+func TestEngineGo(t *testing.T) {
+	e := chester.NewEngine()
+	e.SetPosition("6k1/5ppp/8/8/8/8/5PPP/3R2K1 w - - 0 1", nil)
+
+	var infos int
+	best, err := e.Go(context.Background(), chester.Limits{Depth: 3}, func(chester.Evaluation) {
+		infos++
+	})
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+
+	if best.Best.String() != "d1d8" {
+		t.Errorf("got move %s, want d1d8", best.Best)
+	}
+
+	if infos == 0 {
+		t.Error("onInfo was not called")
+	}
+}
+
+func TestEngineStop(t *testing.T) {
+	e := chester.NewEngine()
+	e.SetPosition("r2q1rk1/ppp2ppp/2np1n2/2b1p1B1/2B1P1b1/2NP1N2/PPP2PPP/R2Q1RK1 w - - 0 8", nil)
+
+	done := make(chan chester.Evaluation)
+	go func() {
+		best, _ := e.Go(context.Background(), chester.Limits{}, nil)
+		done <- best
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+
+	// a second search can't start while the first one runs
+	if _, err := e.Go(context.Background(), chester.Limits{Depth: 1}, nil); !errors.Is(err, chester.ErrSearching) {
+		t.Errorf("got error %v, want %v", err, chester.ErrSearching)
+	}
+
+	e.Stop()
+
+	select {
+	case best := <-done:
+		if best.Best == 0 {
+			t.Error("got no best move")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("search did not stop")
+	}
+}
+
+func TestEngineGo_Infinite(t *testing.T) {
+	e := chester.NewEngine()
+
+	// a single legal move, the search ends right away
+	e.SetPosition("7k/8/8/8/8/8/8/K5R1 b - - 0 1", nil)
+
+	done := make(chan chester.Evaluation, 1)
+	go func() {
+		best, _ := e.Go(context.Background(), chester.Limits{}, nil)
+		done <- best
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("infinite search returned before stop")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// stop waits for the search, so the next one can start right away
+	e.Stop()
+	select {
+	case best := <-done:
+		if best.Best.String() != "h8h7" {
+			t.Errorf("got move %s, want h8h7", best.Best)
+		}
+	default:
+		t.Fatal("stop returned before the search")
+	}
+	if _, err := e.Go(context.Background(), chester.Limits{Depth: 1}, nil); err != nil {
+		t.Errorf("got error %v after stop", err)
+	}
+}
+
+func TestEngineGo_Context(t *testing.T) {
+	e := chester.NewEngine()
+	e.SetPosition("r2q1rk1/ppp2ppp/2np1n2/2b1p1B1/2B1P1b1/2NP1N2/PPP2PPP/R2Q1RK1 w - - 0 8", nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	e.Go(ctx, chester.Limits{}, nil)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("search ran for %s after the context expired", elapsed)
+	}
+}
+
+func TestEnginePonderhit(t *testing.T) {
+	e := chester.NewEngine()
+	e.SetPosition("r2q1rk1/ppp2ppp/2np1n2/2b1p1B1/2B1P1b1/2NP1N2/PPP2PPP/R2Q1RK1 w - - 0 8", nil)
+
+	done := make(chan struct{})
+	go func() {
+		e.Go(context.Background(), chester.Limits{Ponder: true, MoveTime: 20 * time.Millisecond}, nil)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("ponder search finished before ponderhit")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	e.Ponderhit()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("search did not finish after ponderhit")
+	}
+}
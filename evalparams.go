@@ -0,0 +1,241 @@
+package chester
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrInvalidEvalParams is returned when reading evaluation parameters that
+// aren't valid.
+var ErrInvalidEvalParams = errors.New("invalid evaluation parameters")
+
+// EvalParams is a set of parameters of the PeSTO evaluation: the piece
+// values, the piece-square tables and the game phase increments, indexed
+// by [Piece]. Tables are from White's point of view, a8 first and h1 last,
+// and are mirrored for Black. Piece values are added to every square of
+// the tables. The game phase is the sum of the increments of the pieces on
+// the board, up to 24 for the middlegame.
+//
+// Parameters are stored as a JSON object with the keys mgValue, egValue,
+// mgTable, egTable and phaseInc, holding arrays of 6 integers, or 6 arrays
+// of 64 integers for the tables. Keys missing from a file keep the value
+// of [DefaultEvalParams], so a file only needs the parameters it changes.
+type EvalParams struct {
+	MGValue  [Piece(6)]int     `json:"mgValue"`
+	EGValue  [Piece(6)]int     `json:"egValue"`
+	MGTable  [Piece(6)][64]int `json:"mgTable"`
+	EGTable  [Piece(6)][64]int `json:"egTable"`
+	PhaseInc [Piece(6)]int     `json:"phaseInc"`
+}
+
+// DefaultEvalParams returns the parameters [EvalPesto] uses.
+func DefaultEvalParams() *EvalParams {
+	return &EvalParams{
+		MGValue: mgValue,
+		EGValue: egValue,
+		MGTable: [Piece(6)][64]int{
+			mgPawnTable, mgKnightTable, mgBishopTable, mgRookTable, mgQueenTable, mgKingTable,
+		},
+		EGTable: [Piece(6)][64]int{
+			egPawnTable, egKnightTable, egBishopTable, egRookTable, egQueenTable, egKingTable,
+		},
+		PhaseInc: gamephaseInc,
+	}
+}
+
+// LoadEvalParams reads the parameters stored in the file name.
+func LoadEvalParams(name string) (*EvalParams, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadEvalParams(bufio.NewReader(f))
+}
+
+// ReadEvalParams reads parameters in the format described in
+// [EvalParams].
+func ReadEvalParams(r io.Reader) (*EvalParams, error) {
+	// slices tell missing keys and short arrays apart
+	var raw struct {
+		MGValue  []int   `json:"mgValue"`
+		EGValue  []int   `json:"egValue"`
+		MGTable  [][]int `json:"mgTable"`
+		EGTable  [][]int `json:"egTable"`
+		PhaseInc []int   `json:"phaseInc"`
+	}
+
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEvalParams, err)
+	}
+
+	params := DefaultEvalParams()
+	values := []struct {
+		name string
+		src  []int
+		dst  []int
+	}{
+		{"mgValue", raw.MGValue, params.MGValue[:]},
+		{"egValue", raw.EGValue, params.EGValue[:]},
+		{"phaseInc", raw.PhaseInc, params.PhaseInc[:]},
+	}
+	for _, tables := range []struct {
+		name string
+		src  [][]int
+		dst  *[Piece(6)][64]int
+	}{
+		{"mgTable", raw.MGTable, &params.MGTable},
+		{"egTable", raw.EGTable, &params.EGTable},
+	} {
+		if tables.src == nil {
+			continue
+		}
+		if len(tables.src) != len(tables.dst) {
+			return nil, fmt.Errorf("%w: %s has %d tables", ErrInvalidEvalParams, tables.name, len(tables.src))
+		}
+		for piece := range tables.dst {
+			values = append(values, struct {
+				name string
+				src  []int
+				dst  []int
+			}{fmt.Sprintf("%s[%d]", tables.name, piece), tables.src[piece], tables.dst[piece][:]})
+		}
+	}
+
+	for _, v := range values {
+		if v.src == nil {
+			continue
+		}
+		if len(v.src) != len(v.dst) {
+			return nil, fmt.Errorf("%w: %s has %d values", ErrInvalidEvalParams, v.name, len(v.src))
+		}
+		copy(v.dst, v.src)
+	}
+
+	for _, inc := range params.PhaseInc {
+		if inc < 0 || inc > 24 {
+			return nil, fmt.Errorf("%w: phase increment %d", ErrInvalidEvalParams, inc)
+		}
+	}
+	return params, nil
+}
+
+// WriteTo writes the parameters to w in the format described in
+// [EvalParams], with the tables laid out as boards.
+func (ep *EvalParams) WriteTo(w io.Writer) (int64, error) {
+	buf := new(bytes.Buffer)
+
+	writeValues := func(values []int) {
+		for i, v := range values {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			fmt.Fprintf(buf, "%d", v)
+		}
+	}
+	writeTables := func(tables *[Piece(6)][64]int) {
+		for piece := range tables {
+			buf.WriteString("    [\n")
+			for rank := range 8 {
+				buf.WriteString("      ")
+				writeValues(tables[piece][rank*8 : rank*8+8])
+				if rank < 7 {
+					buf.WriteString(",")
+				}
+				buf.WriteString("\n")
+			}
+			buf.WriteString("    ]")
+			if piece < len(tables)-1 {
+				buf.WriteString(",")
+			}
+			buf.WriteString("\n")
+		}
+	}
+
+	buf.WriteString("{\n  \"mgValue\": [")
+	writeValues(ep.MGValue[:])
+	buf.WriteString("],\n  \"egValue\": [")
+	writeValues(ep.EGValue[:])
+	buf.WriteString("],\n  \"mgTable\": [\n")
+	writeTables(&ep.MGTable)
+	buf.WriteString("  ],\n  \"egTable\": [\n")
+	writeTables(&ep.EGTable)
+	buf.WriteString("  ],\n  \"phaseInc\": [")
+	writeValues(ep.PhaseInc[:])
+	buf.WriteString("]\n}\n")
+
+	return buf.WriteTo(w)
+}
+
+// pestoParams are the tables of a set of [EvalParams], with the piece
+// values added and mirrored for Black.
+type pestoParams struct {
+	mg, eg   [Color(2)][Piece(6)][64]int
+	phaseInc [Piece(6)]int
+}
+
+// compile returns the tables of the parameters.
+func (ep *EvalParams) compile() *pestoParams {
+	t := &pestoParams{phaseInc: ep.PhaseInc}
+	for piece := range Piece(6) {
+		for sq := range Square(64) {
+			t.mg[White][piece][sq] = ep.MGValue[piece] + ep.MGTable[piece][sq]
+			t.eg[White][piece][sq] = ep.EGValue[piece] + ep.EGTable[piece][sq]
+			t.mg[Black][piece][sq] = ep.MGValue[piece] + ep.MGTable[piece][sq^56]
+			t.eg[Black][piece][sq] = ep.EGValue[piece] + ep.EGTable[piece][sq^56]
+		}
+	}
+	return t
+}
+
+// taper interpolates the middlegame and endgame scores, from White's point
+// of view, by the game phase. The material table adds the imbalance and
+// scales down the endgame score of drawish endings, known endgames are
+// evaluated by their specialized function instead. It returns the score
+// from the side to move perspective.
+func (t *pestoParams) taper(p *Position, mgScore, egScore int) int {
+	material := pestoMaterialTable().Probe(p)
+	if score, ok := material.Endgame(p); ok {
+		return score
+	}
+
+	mg, eg := material.Imbalance()
+	mgScore += mg
+	egScore += eg
+
+	strong := White
+	if egScore < 0 {
+		strong = Black
+	}
+	egScore = egScore * material.Scale(p, strong) / ScaleNormal
+
+	mgPhase := t.phase(p, material)
+	egPhase := 24 - mgPhase
+	score := (mgScore*mgPhase + egScore*egPhase) / 24
+	score = min(max(score, -mateThreshold+1), mateThreshold-1)
+	if p.active == Black {
+		return -score
+	}
+	return score
+}
+
+// phase returns the game phase of p, whose material entry is material.
+func (t *pestoParams) phase(p *Position, material *MaterialEntry) int {
+	// the material table has the phase of the default increments
+	if t.phaseInc == gamephaseInc {
+		return material.Phase
+	}
+
+	phase := 0
+	for piece := Pawn; piece <= Queen; piece++ {
+		phase += p.pieces[piece].OnesCount() * t.phaseInc[piece]
+	}
+	return min(phase, 24)
+}
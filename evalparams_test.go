@@ -0,0 +1,142 @@
+package chester_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/rand/v2"
+	"strings"
+	"testing"
+
+	"github.com/bluescreen10/chester"
+)
+
+func TestDefaultEvalParams(t *testing.T) {
+	fens := []string{
+		chester.DefaultFEN,
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+		"r2q1rk1/ppp2ppp/2np1n2/2b1p1B1/2B1P1b1/2NP1N2/PPP2PPP/R2Q1RK1 b - - 0 8",
+	}
+
+	for _, fen := range fens {
+		p, _ := chester.ParseFEN(fen)
+		e := chester.NewPestoEvaluatorWithParams(chester.DefaultEvalParams())
+		e.Reset(p)
+
+		if got, want := e.Evaluate(p), chester.EvalPesto(p); got != want {
+			t.Errorf("%s: got %d, want %d", fen, got, want)
+		}
+	}
+}
+
+func TestPestoEvaluatorWithParams(t *testing.T) {
+	params := chester.DefaultEvalParams()
+	params.MGValue[chester.Knight] = 0
+	params.EGValue[chester.Knight] = 0
+	params.PhaseInc = [6]int{0, 2, 2, 3, 6, 0}
+
+	// without knight values the extra knight is worth little
+	p, _ := chester.ParseFEN("4k3/pppp4/8/8/8/8/PPPP4/1N2K3 w - - 0 1")
+	e := chester.NewPestoEvaluatorWithParams(params)
+	e.Reset(p)
+	if got, def := e.Evaluate(p), chester.EvalPesto(p); got >= def-200 {
+		t.Errorf("got %d, want well below the default %d", got, def)
+	}
+
+	// the incremental evaluation matches one computed from scratch
+	rnd := rand.New(rand.NewPCG(4, 8))
+	p, _ = chester.ParseFEN("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	e.Reset(p)
+	p.SetObserver(e)
+	for range 60 {
+		moves, _ := chester.LegalMoves(nil, p)
+		if len(moves) == 0 {
+			break
+		}
+		e.Push()
+		p.Do(moves[rnd.IntN(len(moves))])
+
+		fresh := chester.NewPestoEvaluatorWithParams(params)
+		fresh.Reset(p)
+		if got, want := e.Evaluate(p), fresh.Evaluate(p); got != want {
+			t.Fatalf("%s: got %d, want %d", p.FEN(), got, want)
+		}
+	}
+}
+
+func TestEvalParams_WriteTo(t *testing.T) {
+	params := chester.DefaultEvalParams()
+	params.MGValue[chester.Rook] = 500
+	params.EGTable[chester.King][63] = -42
+	params.PhaseInc[chester.Queen] = 5
+
+	var buf bytes.Buffer
+	if _, err := params.WriteTo(&buf); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+
+	got, err := chester.ReadEvalParams(&buf)
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if *got != *params {
+		t.Errorf("parameters differ after a round trip")
+	}
+}
+
+func TestReadEvalParams(t *testing.T) {
+	got, err := chester.ReadEvalParams(strings.NewReader(`{"mgValue": [100, 300, 300, 500, 900, 0]}`))
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+
+	want := chester.DefaultEvalParams()
+	want.MGValue = [6]int{100, 300, 300, 500, 900, 0}
+	if *got != *want {
+		t.Errorf("missing keys don't keep the default values")
+	}
+}
+
+func TestReadEvalParams_Invalid(t *testing.T) {
+	tests := []string{
+		``,
+		`not json`,
+		`{"mgValues": [100, 300, 300, 500, 900, 0]}`,
+		`{"mgValue": [100, 300, 300, 500, 900]}`,
+		`{"mgTable": [[], [], [], [], []]}`,
+		`{"egTable": [[0], [], [], [], [], []]}`,
+		`{"phaseInc": [0, 1, 1, 2, -4, 0]}`,
+	}
+
+	for _, test := range tests {
+		if _, err := chester.ReadEvalParams(strings.NewReader(test)); !errors.Is(err, chester.ErrInvalidEvalParams) {
+			t.Errorf("%q: got error %v, want %v", test, err, chester.ErrInvalidEvalParams)
+		}
+	}
+}
+
+func TestSearch_EvalParams(t *testing.T) {
+	p, _ := chester.ParseFEN("4k3/pp6/8/3n4/8/8/PP6/3RK3 w - - 0 1")
+
+	best, err := chester.Search(context.Background(), p, chester.SearchOptions{MaxDepth: 3}, nil)
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if best.Best.String() != "d1d5" {
+		t.Errorf("got %s, want d1d5", best.Best)
+	}
+
+	// a knight is a liability with a negative value
+	params := chester.DefaultEvalParams()
+	params.MGValue[chester.Knight] = -500
+	params.EGValue[chester.Knight] = -500
+
+	best, err = chester.Search(context.Background(), p, chester.SearchOptions{MaxDepth: 3, EvalParams: params}, nil)
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if best.Best.String() == "d1d5" {
+		t.Errorf("got %s, want any other move", best.Best)
+	}
+}
@@ -0,0 +1,129 @@
+package chester
+
+// Evaluator performs a static evaluation of a [Position]. Evaluate follows
+// the same conventions as [EvalFunc].
+type Evaluator interface {
+	Evaluate(p *Position) int
+}
+
+// Evaluate calls f(p), so any EvalFunc can be used as an [Evaluator].
+func (f EvalFunc) Evaluate(p *Position) int {
+	return f(p)
+}
+
+// PieceObserver is notified of every change to the pieces of a [Position]
+// it is attached to with [Position.SetObserver].
+type PieceObserver interface {
+	// PieceAdded is called when piece of color is placed on sq.
+	PieceAdded(piece Piece, color Color, sq Square)
+
+	// PieceRemoved is called when piece of color is removed from sq.
+	PieceRemoved(piece Piece, color Color, sq Square)
+
+	// PieceMoved is called when piece of color moves from one square to
+	// another, without changing type.
+	PieceMoved(piece Piece, color Color, from, to Square)
+}
+
+// IncrementalEvaluator is an [Evaluator] that keeps its state up to date by
+// observing the pieces of the position being searched, instead of
+// rescanning the board at every leaf.
+//
+// The search attaches the evaluator to the root position after calling
+// Reset, calls Push before every move is played and Pop once the move has
+// been searched. Evaluate is only called on positions reached that way.
+type IncrementalEvaluator interface {
+	Evaluator
+	PieceObserver
+
+	// Reset computes the state from scratch for p.
+	Reset(p *Position)
+
+	// Push saves the current state.
+	Push()
+
+	// Pop restores the state saved by the last Push.
+	Pop()
+
+	// Clone returns an independent evaluator with the same configuration,
+	// used to give each search thread its own state.
+	Clone() IncrementalEvaluator
+}
+
+// pestoState holds the PeSTO middlegame and endgame sums per color.
+type pestoState struct {
+	mg, eg [Color(2)]int
+}
+
+// pestoEvaluator is the incremental version of [EvalPesto].
+type pestoEvaluator struct {
+	pestoState
+	params *pestoParams
+	stack  []pestoState
+}
+
+// NewPestoEvaluator returns an incremental evaluator computing the same
+// score as [EvalPesto].
+func NewPestoEvaluator() IncrementalEvaluator {
+	return newPestoEvaluator(pesto)
+}
+
+// NewPestoEvaluatorWithParams returns an incremental PeSTO evaluator
+// using params instead of the default parameters.
+func NewPestoEvaluatorWithParams(params *EvalParams) IncrementalEvaluator {
+	return newPestoEvaluator(params.compile())
+}
+
+func newPestoEvaluator(params *pestoParams) *pestoEvaluator {
+	return &pestoEvaluator{params: params, stack: make([]pestoState, 0, maxPly+1)}
+}
+
+// Evaluate returns the tapered PeSTO score from the side to move
+// perspective.
+func (e *pestoEvaluator) Evaluate(p *Position) int {
+	return e.params.taper(p, e.mg[White]-e.mg[Black], e.eg[White]-e.eg[Black])
+}
+
+func (e *pestoEvaluator) PieceAdded(piece Piece, color Color, sq Square) {
+	e.mg[color] += e.params.mg[color][piece][sq]
+	e.eg[color] += e.params.eg[color][piece][sq]
+}
+
+func (e *pestoEvaluator) PieceRemoved(piece Piece, color Color, sq Square) {
+	e.mg[color] -= e.params.mg[color][piece][sq]
+	e.eg[color] -= e.params.eg[color][piece][sq]
+}
+
+func (e *pestoEvaluator) PieceMoved(piece Piece, color Color, from, to Square) {
+	e.mg[color] += e.params.mg[color][piece][to] - e.params.mg[color][piece][from]
+	e.eg[color] += e.params.eg[color][piece][to] - e.params.eg[color][piece][from]
+}
+
+func (e *pestoEvaluator) Reset(p *Position) {
+	e.pestoState = pestoState{}
+	e.stack = e.stack[:0]
+
+	for color := range Color(2) {
+		for piece := Pawn; piece <= King; piece++ {
+			bb := p.pieces[piece] & p.allPieces[color]
+			for bb != 0 {
+				var sq Square
+				sq, bb = bb.PopLSB()
+				e.PieceAdded(piece, color, sq)
+			}
+		}
+	}
+}
+
+func (e *pestoEvaluator) Push() {
+	e.stack = append(e.stack, e.pestoState)
+}
+
+func (e *pestoEvaluator) Pop() {
+	e.pestoState = e.stack[len(e.stack)-1]
+	e.stack = e.stack[:len(e.stack)-1]
+}
+
+func (e *pestoEvaluator) Clone() IncrementalEvaluator {
+	return newPestoEvaluator(e.params)
+}
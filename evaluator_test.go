@@ -0,0 +1,68 @@
+package chester_test
+
+import (
+	"math/rand/v2"
+	"testing"
+
+	"github.com/bluescreen10/chester"
+)
+
+func TestPestoEvaluator(t *testing.T) {
+	fens := []string{
+		chester.DefaultFEN,
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+		"rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8",
+	}
+
+	rnd := rand.New(rand.NewPCG(1, 2))
+
+	for _, fen := range fens {
+		p, _ := chester.ParseFEN(fen)
+		e := chester.NewPestoEvaluator()
+		e.Reset(p)
+		p.SetObserver(e)
+
+		if got, want := e.Evaluate(p), chester.EvalPesto(p); got != want {
+			t.Fatalf("%s: got %d after reset, want %d", fen, got, want)
+		}
+
+		// play random games checking the evaluation after every move and
+		// after taking moves back
+		for range 20 {
+			var positions []chester.Position
+			pos := *p
+
+			for range 40 {
+				moves, _ := chester.LegalMoves(nil, &pos)
+				if len(moves) == 0 {
+					break
+				}
+
+				positions = append(positions, pos)
+				e.Push()
+				pos.Do(moves[rnd.IntN(len(moves))])
+
+				if got, want := e.Evaluate(&pos), chester.EvalPesto(&pos); got != want {
+					t.Fatalf("%s: got %d, want %d", pos.FEN(), got, want)
+				}
+			}
+
+			for i := len(positions) - 1; i >= 0; i-- {
+				e.Pop()
+				if got, want := e.Evaluate(&positions[i]), chester.EvalPesto(&positions[i]); got != want {
+					t.Fatalf("%s: got %d after pop, want %d", positions[i].FEN(), got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestEvalFuncEvaluator(t *testing.T) {
+	p, _ := chester.ParseFEN("4k3/8/8/8/8/8/8/3QK3 w - - 0 1")
+
+	var e chester.Evaluator = chester.EvalFunc(chester.EvalMaterial)
+	if got := e.Evaluate(p); got != 900 {
+		t.Errorf("got %d, want 900", got)
+	}
+}
@@ -0,0 +1,26 @@
+package chester
+
+import (
+	"context"
+	"math"
+)
+
+// SEE exposes the static exchange evaluator to the tests.
+var SEE = see
+
+// TBScore exposes the search score of tablebase results to the tests.
+var TBScore = tbScore
+
+// Quiescence runs the quiescence search of p within alpha and beta with the
+// material evaluation, and returns the score and the number of positions
+// searched.
+func Quiescence(p *Position, alpha, beta int) (int, int64) {
+	ctx := &searchCtx{
+		Context:  context.Background(),
+		maxNodes: math.MaxInt64,
+		eval:     EvalFunc(EvalMaterial),
+		shared:   &sharedSearch{},
+	}
+	score, _ := quiescence(ctx, p, make([]Move, 0, 1024), alpha, beta, 0, 0)
+	return score, ctx.qnodes
+}
@@ -0,0 +1,209 @@
+package chester
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrInvalidGame is returned when encoding or decoding a game record that
+// isn't valid.
+var ErrInvalidGame = errors.New("invalid game record")
+
+// GameResult is the outcome of a game.
+type GameResult uint8
+
+const (
+	ResultUnknown GameResult = iota
+	ResultWhiteWins
+	ResultBlackWins
+	ResultDraw
+)
+
+// String returns the result in PGN notation, or "*" when it is unknown.
+func (r GameResult) String() string {
+	switch r {
+	case ResultWhiteWins:
+		return "1-0"
+	case ResultBlackWins:
+		return "0-1"
+	case ResultDraw:
+		return "1/2-1/2"
+	default:
+		return "*"
+	}
+}
+
+// gameScoresFlag is set in the flags of a game record when the moves have
+// scores.
+const gameScoresFlag = 1
+
+// Game is a record of a game played from Start.
+type Game struct {
+	// Start is the position the game starts from.
+	Start Position
+
+	// Moves are the moves played, in order.
+	Moves []Move
+
+	// Scores are the search scores of the positions the moves were played
+	// from, from the side to move perspective. It is either empty or has
+	// one score per move.
+	Scores []Score
+
+	// Result is the outcome of the game.
+	Result GameResult
+}
+
+// GameWriter writes game records to a stream. Each record is:
+//
+//	32 bytes  start position, see [Position.MarshalBinary]
+//	1 byte    result, a [GameResult]
+//	1 byte    flags, bit 0 set when the moves have scores
+//	uvarint   number of moves
+//	per move  1 byte with the index of the move in the moves returned by
+//	          [LegalMoves] for the position it is played from, followed
+//	          by the score as a varint when the moves have scores
+//
+// Moves take a single byte and scores one or two in most positions, a
+// fraction of the size of FEN strings. Writes are buffered, Flush must be
+// called once done.
+type GameWriter struct {
+	w     *bufio.Writer
+	buf   []byte
+	moves []Move
+}
+
+// NewGameWriter returns a writer writing game records to w.
+func NewGameWriter(w io.Writer) *GameWriter {
+	return &GameWriter{w: bufio.NewWriter(w), moves: make([]Move, 0, 256)}
+}
+
+// Write writes g to the stream. All the moves must be legal.
+func (gw *GameWriter) Write(g *Game) error {
+	if len(g.Scores) != 0 && len(g.Scores) != len(g.Moves) {
+		return fmt.Errorf("%w: %d scores for %d moves", ErrInvalidGame, len(g.Scores), len(g.Moves))
+	}
+	if g.Result > ResultDraw {
+		return fmt.Errorf("%w: bad result", ErrInvalidGame)
+	}
+
+	var err error
+	if gw.buf, err = g.Start.AppendBinary(gw.buf[:0]); err != nil {
+		return err
+	}
+
+	var flags byte
+	if len(g.Scores) > 0 {
+		flags |= gameScoresFlag
+	}
+	gw.buf = append(gw.buf, byte(g.Result), flags)
+	gw.buf = binary.AppendUvarint(gw.buf, uint64(len(g.Moves)))
+
+	p := g.Start.Copy()
+	for i, m := range g.Moves {
+		gw.moves, _ = LegalMoves(gw.moves[:0], &p)
+		index := moveIndex(gw.moves, m)
+		if index < 0 {
+			return fmt.Errorf("%w: illegal move %s in %s", ErrInvalidGame, m, p.FEN())
+		}
+
+		gw.buf = append(gw.buf, byte(index))
+		if len(g.Scores) > 0 {
+			gw.buf = binary.AppendVarint(gw.buf, int64(g.Scores[i]))
+		}
+		p.Do(m)
+	}
+
+	_, err = gw.w.Write(gw.buf)
+	return err
+}
+
+// Flush writes any buffered data to the underlying writer.
+func (gw *GameWriter) Flush() error {
+	return gw.w.Flush()
+}
+
+// moveIndex returns the index of m in moves, or -1 when it isn't there.
+func moveIndex(moves []Move, m Move) int {
+	for i, move := range moves {
+		if move == m {
+			return i
+		}
+	}
+	return -1
+}
+
+// GameReader reads game records written by a [GameWriter].
+type GameReader struct {
+	r     *bufio.Reader
+	buf   [PositionSize + 2]byte
+	moves []Move
+}
+
+// NewGameReader returns a reader reading game records from r.
+func NewGameReader(r io.Reader) *GameReader {
+	return &GameReader{r: bufio.NewReader(r), moves: make([]Move, 0, 256)}
+}
+
+// Read reads the next game into g, reusing its slices. It returns [io.EOF]
+// when there are no more games and [io.ErrUnexpectedEOF] when the stream
+// ends in the middle of one.
+func (gr *GameReader) Read(g *Game) error {
+	if _, err := io.ReadFull(gr.r, gr.buf[:]); err != nil {
+		return err
+	}
+	if err := g.Start.UnmarshalBinary(gr.buf[:PositionSize]); err != nil {
+		return err
+	}
+
+	result, flags := GameResult(gr.buf[PositionSize]), gr.buf[PositionSize+1]
+	if result > ResultDraw || flags&^gameScoresFlag != 0 {
+		return fmt.Errorf("%w: bad header", ErrInvalidGame)
+	}
+	g.Result = result
+
+	n, err := binary.ReadUvarint(gr.r)
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+
+	g.Moves = g.Moves[:0]
+	g.Scores = g.Scores[:0]
+
+	p := g.Start.Copy()
+	for range n {
+		index, err := gr.r.ReadByte()
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+
+		gr.moves, _ = LegalMoves(gr.moves[:0], &p)
+		if int(index) >= len(gr.moves) {
+			return fmt.Errorf("%w: bad move index %d in %s", ErrInvalidGame, index, p.FEN())
+		}
+		m := gr.moves[index]
+		g.Moves = append(g.Moves, m)
+
+		if flags&gameScoresFlag != 0 {
+			score, err := binary.ReadVarint(gr.r)
+			if err != nil {
+				return unexpectedEOF(err)
+			}
+			g.Scores = append(g.Scores, Score(score))
+		}
+		p.Do(m)
+	}
+	return nil
+}
+
+// unexpectedEOF turns an io.EOF in the middle of a record into an
+// io.ErrUnexpectedEOF.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
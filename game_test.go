@@ -0,0 +1,138 @@
+package chester_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"slices"
+	"testing"
+
+	"github.com/bluescreen10/chester"
+)
+
+// randomGame plays random moves from fen, with random scores when
+// withScores is set.
+func randomGame(rnd *rand.Rand, fen string, plies int, withScores bool) *chester.Game {
+	p, _ := chester.ParseFEN(fen)
+	g := &chester.Game{Start: *p, Result: chester.GameResult(rnd.IntN(4))}
+
+	for range plies {
+		moves, _ := chester.LegalMoves(nil, p)
+		if len(moves) == 0 {
+			break
+		}
+		m := moves[rnd.IntN(len(moves))]
+		g.Moves = append(g.Moves, m)
+		if withScores {
+			g.Scores = append(g.Scores, chester.Score(rnd.IntN(4001)-2000))
+		}
+		p.Do(m)
+	}
+	return g
+}
+
+func TestGameWriter(t *testing.T) {
+	rnd := rand.New(rand.NewPCG(5, 0))
+
+	var games []*chester.Game
+	for i := range 20 {
+		games = append(games, randomGame(rnd, binaryFENs[i%len(binaryFENs)], rnd.IntN(200), i%2 == 0))
+	}
+
+	var buf bytes.Buffer
+	w := chester.NewGameWriter(&buf)
+	for _, g := range games {
+		if err := w.Write(g); err != nil {
+			t.Fatalf("got error %v", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+
+	r := chester.NewGameReader(&buf)
+	var got chester.Game
+	for i, want := range games {
+		if err := r.Read(&got); err != nil {
+			t.Fatalf("game %d: got error %v", i, err)
+		}
+		if got.Start.FEN() != want.Start.FEN() || got.Result != want.Result {
+			t.Errorf("game %d: got %s %s, want %s %s", i, got.Start.FEN(), got.Result, want.Start.FEN(), want.Result)
+		}
+		if !slices.Equal(got.Moves, want.Moves) {
+			t.Errorf("game %d: got moves %v, want %v", i, got.Moves, want.Moves)
+		}
+		if !slices.Equal(got.Scores, want.Scores) {
+			t.Errorf("game %d: got scores %v, want %v", i, got.Scores, want.Scores)
+		}
+	}
+	if err := r.Read(&got); err != io.EOF {
+		t.Errorf("got error %v, want %v", err, io.EOF)
+	}
+}
+
+func TestGameWriter_Invalid(t *testing.T) {
+	p, _ := chester.ParseFEN(chester.DefaultFEN)
+
+	tests := map[string]*chester.Game{
+		"illegal move": {Start: *p, Moves: []chester.Move{chester.NewMove(chester.SQ_E2, chester.SQ_E5)}},
+		"scores":       {Start: *p, Moves: []chester.Move{chester.NewMove(chester.SQ_E2, chester.SQ_E4)}, Scores: []chester.Score{1, 2}},
+		"result":       {Start: *p, Result: chester.ResultDraw + 1},
+	}
+
+	for name, g := range tests {
+		w := chester.NewGameWriter(io.Discard)
+		if err := w.Write(g); !errors.Is(err, chester.ErrInvalidGame) {
+			t.Errorf("%s: got error %v, want %v", name, err, chester.ErrInvalidGame)
+		}
+	}
+}
+
+func TestGameReader_Invalid(t *testing.T) {
+	rnd := rand.New(rand.NewPCG(5, 1))
+
+	var buf bytes.Buffer
+	w := chester.NewGameWriter(&buf)
+	w.Write(randomGame(rnd, chester.DefaultFEN, 40, true))
+	w.Flush()
+	valid := buf.Bytes()
+
+	var g chester.Game
+	for n := 1; n < len(valid); n++ {
+		r := chester.NewGameReader(bytes.NewReader(valid[:n]))
+		if err := r.Read(&g); err != io.ErrUnexpectedEOF {
+			t.Fatalf("%d bytes: got error %v, want %v", n, err, io.ErrUnexpectedEOF)
+		}
+	}
+
+	// the start position has no kings
+	data := bytes.Clone(valid)
+	copy(data, append([]byte{3}, make([]byte, chester.PositionSize-1)...))
+	if err := chester.NewGameReader(bytes.NewReader(data)).Read(&g); !errors.Is(err, chester.ErrInvalidPosition) {
+		t.Errorf("got error %v, want %v", err, chester.ErrInvalidPosition)
+	}
+
+	// the first move index is out of range
+	data = bytes.Clone(valid)
+	data[chester.PositionSize+3] = 200
+	r := chester.NewGameReader(bytes.NewReader(data))
+	if err := r.Read(&g); !errors.Is(err, chester.ErrInvalidGame) {
+		t.Errorf("got error %v, want %v", err, chester.ErrInvalidGame)
+	}
+}
+
+func TestGameResult_String(t *testing.T) {
+	tests := map[chester.GameResult]string{
+		chester.ResultUnknown:   "*",
+		chester.ResultWhiteWins: "1-0",
+		chester.ResultBlackWins: "0-1",
+		chester.ResultDraw:      "1/2-1/2",
+	}
+
+	for result, want := range tests {
+		if got := result.String(); got != want {
+			t.Errorf("got %s, want %s", got, want)
+		}
+	}
+}
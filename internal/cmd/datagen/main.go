@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/bluescreen10/chester"
+)
+
+// options are the settings of the games, shared by every worker.
+type options struct {
+	dir       string
+	games     int
+	nodes     int64
+	depth     int
+	random    int
+	maxPlies  int
+	hash      uint64
+	seed      uint64
+	openings  []string
+	positions atomic.Int64
+}
+
+// record is a position of a game with the search score, from White's
+// point of view, waiting for the game result.
+type record struct {
+	fen   string
+	score int
+}
+
+func main() {
+	var opts options
+
+	flag.StringVar(&opts.dir, "dir", "data", "directory the shards are written to")
+	shards := flag.Int("shards", 16, "number of shards to generate")
+	flag.IntVar(&opts.games, "games", 100, "games per shard")
+	flag.Int64Var(&opts.nodes, "nodes", 5000, "nodes searched per move, zero for no limit")
+	flag.IntVar(&opts.depth, "depth", 0, "depth searched per move, zero for no limit")
+	flag.IntVar(&opts.random, "random", 8, "random plies played after the opening")
+	flag.IntVar(&opts.maxPlies, "maxplies", 400, "plies after which a game is a draw")
+	openings := flag.String("openings", "", "file with opening positions, one FEN or EPD per line")
+	hash := flag.Uint64("hash", 16, "transposition table size per worker, in MB")
+	flag.Uint64Var(&opts.seed, "seed", 1, "random seed of the openings")
+	workers := flag.Int("workers", runtime.GOMAXPROCS(0), "games played in parallel")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: datagen [flags]\n\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "Plays engine games and writes their quiet positions as \"fen | score | result\",\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "with the score in centipawns and the result (1.0, 0.5 or 0.0) for White.\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "Shards already in the directory are kept, so an interrupted run resumes.\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if opts.nodes == 0 && opts.depth == 0 {
+		log.Fatalf("either -nodes or -depth must be set")
+	}
+	opts.hash = *hash * 1024 * 1024
+
+	if *openings != "" {
+		var err error
+		if opts.openings, err = readOpenings(*openings); err != nil {
+			log.Fatalf("error reading openings: %v", err)
+		}
+		log.Printf("loaded %d openings", len(opts.openings))
+	}
+
+	if err := os.MkdirAll(opts.dir, 0o755); err != nil {
+		log.Fatalf("error creating directory: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	shardc := make(chan int)
+	go func() {
+		defer close(shardc)
+		for shard := range *shards {
+			if _, err := os.Stat(shardName(opts.dir, shard)); err == nil {
+				continue
+			}
+			select {
+			case shardc <- shard:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for range max(*workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tt := chester.NewTranspositionTable(opts.hash)
+			for shard := range shardc {
+				if err := generateShard(ctx, &opts, tt, shard); err != nil {
+					if !errors.Is(err, context.Canceled) {
+						log.Printf("shard %d: %v", shard, err)
+					}
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	log.Printf("wrote %d positions", opts.positions.Load())
+}
+
+// shardName returns the name of the file of shard.
+func shardName(dir string, shard int) string {
+	return filepath.Join(dir, fmt.Sprintf("shard-%05d.txt", shard))
+}
+
+// readOpenings reads the positions of an opening file.
+func readOpenings(name string) ([]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var openings []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+
+		// EPD lines have no move counters
+		fen := strings.Join(fields[:4], " ") + " 0 1"
+		if _, err := chester.ParseFEN(fen); err != nil {
+			return nil, fmt.Errorf("%q: %w", scanner.Text(), err)
+		}
+		openings = append(openings, fen)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(openings) == 0 {
+		return nil, fmt.Errorf("no positions in %s", name)
+	}
+	return openings, nil
+}
+
+// generateShard plays the games of shard. They are written to a temporary
+// file renamed once the shard is complete.
+func generateShard(ctx context.Context, opts *options, tt *chester.TranspositionTable, shard int) error {
+	name := shardName(opts.dir, shard)
+	f, err := os.Create(name + ".tmp")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	rnd := rand.New(rand.NewPCG(opts.seed, uint64(shard)))
+
+	positions := 0
+	for range opts.games {
+		records, result, err := playGame(ctx, opts, tt, rnd)
+		if err != nil {
+			return err
+		}
+		for _, r := range records {
+			fmt.Fprintf(w, "%s | %d | %s\n", r.fen, r.score, result)
+		}
+		positions += len(records)
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(name+".tmp", name); err != nil {
+		return err
+	}
+
+	opts.positions.Add(int64(positions))
+	log.Printf("shard %d: %d games, %d positions", shard, opts.games, positions)
+	return nil
+}
+
+// playGame plays a game from an opening followed by random plies and
+// returns the quiet positions searched with the result of the game.
+func playGame(ctx context.Context, opts *options, tt *chester.TranspositionTable, rnd *rand.Rand) ([]record, string, error) {
+	for {
+		p := startPosition(opts, rnd)
+		if p == nil {
+			continue
+		}
+
+		tt.Clear()
+		history := []uint64{p.Hash()}
+		var records []record
+
+		for ply := 0; ; ply++ {
+			if result, over := gameResult(p, history, ply >= opts.maxPlies); over {
+				return records, result, nil
+			}
+
+			best, err := chester.Search(ctx, p, chester.SearchOptions{
+				MaxNodes:           opts.nodes,
+				MaxDepth:           opts.depth,
+				TranspositionTable: tt,
+				History:            history[:len(history)-1],
+			}, nil)
+			if err != nil {
+				return nil, "", err
+			}
+
+			// book moves are played without a search
+			if best.Nodes > 0 && !best.Score.IsMate() && !p.InCheck() && !isNoisy(p, best.Best) {
+				score := best.Score.Centipawns()
+				if p.Active() == chester.Black {
+					score = -score
+				}
+				records = append(records, record{fen: p.FEN(), score: score})
+			}
+
+			p.Do(best.Best)
+			history = append(history, p.Hash())
+		}
+	}
+}
+
+// startPosition returns a random opening, or the initial position, after
+// the random plies. It returns nil when the game ends during them.
+func startPosition(opts *options, rnd *rand.Rand) *chester.Position {
+	fen := chester.DefaultFEN
+	if len(opts.openings) > 0 {
+		fen = opts.openings[rnd.IntN(len(opts.openings))]
+	}
+	p, _ := chester.ParseFEN(fen)
+
+	var moves []chester.Move
+	for range opts.random {
+		moves, _ = chester.LegalMoves(moves[:0], p)
+		if len(moves) == 0 {
+			return nil
+		}
+		p.Do(moves[rnd.IntN(len(moves))])
+	}
+
+	if moves, _ = chester.LegalMoves(moves[:0], p); len(moves) == 0 {
+		return nil
+	}
+	return p
+}
+
+// isNoisy reports whether m captures or promotes.
+func isNoisy(p *chester.Position, m chester.Move) bool {
+	if m.IsPromotion() || p.Enemies()&chester.NewBitboardFromSquare(m.To()) != 0 {
+		return true
+	}
+	return p.Get(m.From()) == chester.Pawn && m.To() == p.EnPassantTarget()
+}
+
+// gameResult returns the result of the game at p, with history the hashes
+// of the positions played, and whether it is over. Games reaching the ply
+// limit are drawn.
+func gameResult(p *chester.Position, history []uint64, limit bool) (string, bool) {
+	const (
+		whiteWins = "1.0"
+		blackWins = "0.0"
+		draw      = "0.5"
+	)
+
+	moves, inCheck := chester.LegalMoves(nil, p)
+	switch {
+	case len(moves) == 0 && inCheck && p.Active() == chester.White:
+		return blackWins, true
+	case len(moves) == 0 && inCheck:
+		return whiteWins, true
+	case len(moves) == 0, limit, p.HalfMoves() >= 100, insufficientMaterial(p):
+		return draw, true
+	}
+
+	// threefold repetition, within the moves since the last capture or
+	// pawn move
+	repetitions := 0
+	for i := len(history) - 1; i >= 0 && i >= len(history)-1-int(p.HalfMoves()); i-- {
+		if history[i] == p.Hash() {
+			repetitions++
+		}
+	}
+	return draw, repetitions >= 3
+}
+
+// insufficientMaterial reports whether neither side can checkmate: there
+// are no pawns, rooks or queens of either color, and at most one minor
+// piece on the board.
+func insufficientMaterial(p *chester.Position) bool {
+	pawns := p.WhitePawns() | p.BlackPawns()
+	majors := p.WhiteRooks() | p.BlackRooks() | p.WhiteQueens() | p.BlackQueens()
+	if pawns|majors != 0 {
+		return false
+	}
+	minors := p.WhiteKnights() | p.BlackKnights() | p.WhiteBishops() | p.BlackBishops()
+	return minors.OnesCount() <= 1
+}
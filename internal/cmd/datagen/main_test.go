@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/bluescreen10/chester"
+)
+
+func TestInsufficientMaterial(t *testing.T) {
+	tests := []struct {
+		name string
+		fen  string
+		want bool
+	}{
+		{"bare kings", "4k3/8/8/8/8/8/8/4K3 w - - 0 1", true},
+		{"knight", "4k3/8/8/8/8/8/8/3NK3 b - - 0 1", true},
+		{"bishop", "3bk3/8/8/8/8/8/8/4K3 w - - 0 1", true},
+		{"knight each", "3nk3/8/8/8/8/8/8/3NK3 w - - 0 1", false},
+		{"queen, weak side to move", "4k3/8/8/8/8/8/8/3QK3 b - - 0 1", false},
+		{"rook, weak side to move", "4k3/8/8/8/8/8/8/3RK3 b - - 0 1", false},
+		{"pawn, weak side to move", "4k3/8/8/8/8/8/3P4/4K3 b - - 0 1", false},
+		{"black pawn, weak side to move", "4k3/3p4/8/8/8/8/8/4K3 w - - 0 1", false},
+		{"minor piece, weak side to move", "4k3/8/8/8/8/8/8/2NBK3 b - - 0 1", false},
+	}
+
+	for _, test := range tests {
+		p, err := chester.ParseFEN(test.fen)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if got := insufficientMaterial(p); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
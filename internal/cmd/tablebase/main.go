@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/bluescreen10/chester"
+)
+
+// pieces are the letters of the pieces besides the kings.
+const pieces = "QRBNP"
+
+func main() {
+	dir := flag.String("dir", "tablebases", "directory the tables are written to")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: tablebase [-dir path] [endgame ...]\n\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "Generates the endgames, like KQKR, and the ones they convert to.\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "Without arguments every endgame with up to %d pieces is generated.\n\n", chester.TablebaseMaxPieces)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	codes := flag.Args()
+	if len(codes) == 0 {
+		codes = allEndgames()
+	}
+
+	// tables already in dir aren't generated again
+	tb := chester.NewTablebase()
+	if _, err := os.Stat(*dir); err == nil {
+		if err := tb.Load(*dir); err != nil {
+			log.Fatalf("error loading tables: %v", err)
+		}
+	}
+
+	for _, code := range codes {
+		start := time.Now()
+		if err := tb.Generate(code); err != nil {
+			log.Fatalf("error generating %s: %v", code, err)
+		}
+		log.Printf("%s generated in %v", code, time.Since(start).Round(time.Millisecond))
+	}
+
+	if err := tb.Save(*dir); err != nil {
+		log.Fatalf("error saving tables: %v", err)
+	}
+}
+
+// allEndgames returns the codes of the endgames with three and four pieces.
+func allEndgames() []string {
+	var codes []string
+	for _, a := range pieces {
+		codes = append(codes, "K"+string(a)+"K")
+	}
+	for i, a := range pieces {
+		for _, b := range pieces[i:] {
+			codes = append(codes, "K"+string(a)+string(b)+"K")
+		}
+		for _, b := range pieces[i:] {
+			codes = append(codes, "K"+string(a)+"K"+string(b))
+		}
+	}
+	return codes
+}
@@ -0,0 +1,623 @@
+// Tune fits the PeSTO evaluation parameters to labeled positions with
+// Texel's method, minimizing the error between the game results and the
+// sigmoid of the evaluation of the quiet positions.
+//
+// Every parameter of [chester.EvalParams] is tuned: the piece values, the
+// piece-square tables and the game phase increments of the pawns to the
+// queens. The phase increments are tuned as real numbers with their own
+// learning rate and rounded when written, the phase being capped at 24.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io"
+	"log"
+	"math"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bluescreen10/chester"
+)
+
+const (
+	packageName = "chester"
+	fileName    = "pesto.go"
+)
+
+// pieceNames are the names of the pieces in the tables of the parameter
+// file.
+var pieceNames = [6]string{"Pawn", "Knight", "Bishop", "Rook", "Queen", "King"}
+
+// Layout of the parameter vector: the middlegame and endgame values of
+// the pieces but the king, the middlegame and endgame piece-square tables,
+// then the game phase increments of the pieces but the king.
+const (
+	mgValueIndex = 0
+	egValueIndex = 5
+	mgTableIndex = 10
+	egTableIndex = mgTableIndex + 6*64
+	phaseIndex   = egTableIndex + 6*64
+	paramCount   = phaseIndex + 5
+)
+
+// maxQuiescencePly limits the quiescence search resolving the positions.
+const maxQuiescencePly = 16
+
+// params are the evaluation parameters being tuned.
+type params [paramCount]float64
+
+// sample is a quiet position of the data set, with the pieces packed as
+// color<<9 | piece<<6 | square.
+type sample struct {
+	pieces   []uint16
+	counts   [5]float64
+	scale    [2]float64
+	imbMG    float64
+	imbEG    float64
+	result   float64
+	fullEval float64
+}
+
+func main() {
+	data := flag.String("data", "", "labeled positions, one FEN or EPD per line ending with the result")
+	in := flag.String("in", fileName, "parameter file with the initial values, Go source or .json")
+	out := flag.String("out", fileName, "parameter file to write, Go source or .json")
+	epochs := flag.Int("epochs", 500, "number of iterations over the data set")
+	rate := flag.Float64("rate", 1, "learning rate, in centipawns")
+	phaseRate := flag.Float64("phaserate", 0.01, "learning rate of the game phase increments")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: tune -data file [flags]\n\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "Tunes the PeSTO piece values, piece-square tables and game phase increments\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "to the results of labeled positions with Texel's method.\n\n")
+		flag.PrintDefaults()
+	}
+	k := flag.Float64("k", 0, "sigmoid scaling constant, fitted to the data when zero")
+	flag.Parse()
+
+	initial, phaseInc, err := readParams(*in)
+	if err != nil {
+		log.Fatalf("error reading parameters: %v", err)
+	}
+
+	tuned := initial
+	if *epochs > 0 {
+		if *data == "" {
+			log.Fatalf("missing -data")
+		}
+
+		samples, err := loadSamples(*data)
+		if err != nil {
+			log.Fatalf("error loading positions: %v", err)
+		}
+		if len(samples) == 0 {
+			log.Fatalf("no quiet positions in %s", *data)
+		}
+		log.Printf("loaded %d quiet positions", len(samples))
+
+		if *k == 0 {
+			*k = fitK(samples, &initial)
+			log.Printf("fitted K = %.4f", *k)
+		}
+
+		tuned = tune(samples, initial, *k, *rate, *phaseRate, *epochs)
+	}
+
+	if err := writeParams(*out, &tuned, phaseInc); err != nil {
+		log.Fatalf("error writing parameters: %v", err)
+	}
+}
+
+// loadSamples reads the labeled positions in the file name and resolves
+// them with a quiescence search. The result is the last field of each
+// line: 1-0, 0-1, 1/2-1/2, or the score of white as 1.0, 0.5 or 0.0, with
+// any quotes, brackets and semicolons around it ignored. Positions in
+// check or evaluated by a specialized endgame function are skipped.
+func loadSamples(name string) ([]sample, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	lines := make(chan string, 1024)
+	results := make(chan sample, 1024)
+
+	var wg sync.WaitGroup
+	for range runtime.GOMAXPROCS(0) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			table := chester.NewMaterialTable(1024 * 1024)
+			for line := range lines {
+				if s, ok := parseSample(line, table); ok {
+					results <- s
+				}
+			}
+		}()
+	}
+
+	var samples []sample
+	done := make(chan struct{})
+	go func() {
+		for s := range results {
+			samples = append(samples, s)
+		}
+		close(done)
+	}()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines <- scanner.Text()
+	}
+	close(lines)
+	wg.Wait()
+	close(results)
+	<-done
+
+	return samples, scanner.Err()
+}
+
+// parseSample parses one labeled position and resolves it.
+func parseSample(line string, table *chester.MaterialTable) (sample, bool) {
+	fields := strings.Fields(strings.NewReplacer(`"`, " ", ";", " ", "[", " ", "]", " ", "|", " ").Replace(line))
+	if len(fields) < 5 {
+		return sample{}, false
+	}
+
+	var result float64
+	switch fields[len(fields)-1] {
+	case "1-0", "1.0", "1":
+		result = 1
+	case "0-1", "0.0", "0":
+		result = 0
+	case "1/2-1/2", "0.5":
+		result = 0.5
+	default:
+		return sample{}, false
+	}
+
+	// EPD lines have no move counters
+	fen := fields[:4]
+	if len(fields) > 6 && isNumber(fields[4]) && isNumber(fields[5]) {
+		fen = fields[:6]
+	}
+
+	p, err := chester.ParseFEN(strings.Join(append(fen, "0", "1")[:6], " "))
+	if err != nil || p.InCheck() {
+		return sample{}, false
+	}
+
+	leaf := quiescence(p, -chester.MateScore, chester.MateScore, 0)
+	if leaf.InCheck() {
+		return sample{}, false
+	}
+
+	entry := table.Probe(leaf)
+	if _, ok := entry.Endgame(leaf); ok {
+		return sample{}, false
+	}
+
+	s := sample{result: result}
+	mg, eg := entry.Imbalance()
+	s.imbMG, s.imbEG = float64(mg), float64(eg)
+	for color := range chester.Color(2) {
+		s.scale[color] = float64(entry.Scale(leaf, color)) / chester.ScaleNormal
+	}
+
+	for sq := range chester.Square(64) {
+		if piece := leaf.Get(sq); piece != chester.Empty {
+			color := chester.White
+			if leaf.WhitePieces()&chester.NewBitboardFromSquare(sq) == 0 {
+				color = chester.Black
+			}
+			s.pieces = append(s.pieces, uint16(color)<<9|uint16(piece)<<6|uint16(sq))
+			if piece != chester.King {
+				s.counts[piece]++
+			}
+		}
+	}
+
+	s.fullEval = float64(chester.EvalPesto(leaf))
+	if leaf.Active() == chester.Black {
+		s.fullEval = -s.fullEval
+	}
+	return s, true
+}
+
+// isNumber reports whether s is a decimal number.
+func isNumber(s string) bool {
+	_, err := strconv.Atoi(s)
+	return err == nil
+}
+
+// quiescence searches the captures of p and returns the position at the
+// end of the principal variation.
+func quiescence(p *chester.Position, alpha, beta chester.Score, ply int) *chester.Position {
+	leaf, _ := quiesce(p, alpha, beta, ply)
+	return leaf
+}
+
+func quiesce(p *chester.Position, alpha, beta chester.Score, ply int) (*chester.Position, chester.Score) {
+	standPat := chester.Score(chester.EvalPesto(p))
+	if standPat >= beta || ply >= maxQuiescencePly {
+		return p, standPat
+	}
+
+	leaf := p
+	alpha = max(alpha, standPat)
+
+	moves, _ := chester.CaptureMoves(nil, p)
+	for _, m := range moves {
+		child := p.Copy()
+		child.Do(m)
+
+		childLeaf, score := quiesce(&child, -beta, -alpha, ply+1)
+		score = -score
+		if score >= beta {
+			return childLeaf, score
+		}
+		if score > alpha {
+			alpha, leaf = score, childLeaf
+		}
+	}
+	return leaf, alpha
+}
+
+// evaluate returns the evaluation of s from the point of view of white.
+// When grad is not nil, g times the derivative of the evaluation with
+// respect to each parameter is added to it.
+func evaluate(s *sample, w *params, grad *params, g float64) float64 {
+	mg, eg := s.imbMG, s.imbEG
+	for _, packed := range s.pieces {
+		color, piece, sq := packed>>9, int(packed>>6&7), int(packed&63)
+		sign := 1.0
+		if color == 1 {
+			sign, sq = -1, sq^56
+		}
+
+		mg += sign * w[mgTableIndex+piece*64+sq]
+		eg += sign * w[egTableIndex+piece*64+sq]
+		if piece != 5 {
+			mg += sign * w[mgValueIndex+piece]
+			eg += sign * w[egValueIndex+piece]
+		}
+	}
+
+	scale := s.scale[chester.White]
+	if eg < 0 {
+		scale = s.scale[chester.Black]
+	}
+
+	var phase float64
+	for piece, n := range s.counts {
+		phase += n * w[phaseIndex+piece]
+	}
+	capped := phase >= 24
+	phase = min(phase, 24) / 24
+	score := mg*phase + eg*scale*(1-phase)
+
+	if grad != nil {
+		if !capped {
+			for piece, n := range s.counts {
+				grad[phaseIndex+piece] += g * n * (mg - eg*scale) / 24
+			}
+		}
+
+		for _, packed := range s.pieces {
+			color, piece, sq := packed>>9, int(packed>>6&7), int(packed&63)
+			sign := g
+			if color == 1 {
+				sign, sq = -g, sq^56
+			}
+
+			grad[mgTableIndex+piece*64+sq] += sign * phase
+			grad[egTableIndex+piece*64+sq] += sign * scale * (1 - phase)
+			if piece != 5 {
+				grad[mgValueIndex+piece] += sign * phase
+				grad[egValueIndex+piece] += sign * scale * (1 - phase)
+			}
+		}
+	}
+	return score
+}
+
+// sigmoid maps an evaluation to the expected result.
+func sigmoid(k, score float64) float64 {
+	return 1 / (1 + math.Pow(10, -k*score/400))
+}
+
+// meanError returns the mean squared error of the evaluations of the
+// samples. With fullEval it uses the evaluation of the engine, otherwise
+// the one from w.
+func meanError(samples []sample, k float64, w *params, fullEval bool) float64 {
+	var sum float64
+	for i := range samples {
+		score := samples[i].fullEval
+		if !fullEval {
+			score = evaluate(&samples[i], w, nil, 0)
+		}
+		diff := samples[i].result - sigmoid(k, score)
+		sum += diff * diff
+	}
+	return sum / float64(len(samples))
+}
+
+// fitK returns the sigmoid scaling constant minimizing the error of the
+// engine evaluation.
+func fitK(samples []sample, w *params) float64 {
+	lo, hi := 0.0, 3.0
+	for range 50 {
+		a, b := lo+(hi-lo)/3, hi-(hi-lo)/3
+		if meanError(samples, a, w, true) < meanError(samples, b, w, true) {
+			hi = b
+		} else {
+			lo = a
+		}
+	}
+	return (lo + hi) / 2
+}
+
+// tune minimizes the mean squared error of the samples by gradient
+// descent with Adam, starting from w. The phase increments are updated
+// with phaseRate and kept within 0 and 24.
+func tune(samples []sample, w params, k, rate, phaseRate float64, epochs int) params {
+	const beta1, beta2, epsilon = 0.9, 0.999, 1e-8
+
+	workers := runtime.GOMAXPROCS(0)
+	chunk := (len(samples) + workers - 1) / workers
+
+	var m, v params
+	for epoch := 1; epoch <= epochs; epoch++ {
+		grads := make([]params, workers)
+
+		var wg sync.WaitGroup
+		for i := range workers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := i * chunk; j < min(len(samples), (i+1)*chunk); j++ {
+					s := &samples[j]
+					e := sigmoid(k, evaluate(s, &w, nil, 0))
+					g := -2 * (s.result - e) * e * (1 - e) * k * math.Ln10 / 400
+					evaluate(s, &w, &grads[i], g/float64(len(samples)))
+				}
+			}()
+		}
+		wg.Wait()
+
+		for i := range w {
+			var g float64
+			for _, grad := range grads {
+				g += grad[i]
+			}
+			m[i] = beta1*m[i] + (1-beta1)*g
+			v[i] = beta2*v[i] + (1-beta2)*g*g
+			mHat := m[i] / (1 - math.Pow(beta1, float64(epoch)))
+			vHat := v[i] / (1 - math.Pow(beta2, float64(epoch)))
+			if i >= phaseIndex {
+				w[i] = min(max(w[i]-phaseRate*mHat/(math.Sqrt(vHat)+epsilon), 0), 24)
+			} else {
+				w[i] -= rate * mHat / (math.Sqrt(vHat) + epsilon)
+			}
+		}
+
+		if epoch%10 == 0 || epoch == epochs {
+			log.Printf("epoch %d error %.6f", epoch, meanError(samples, k, &w, false))
+		}
+	}
+	return w
+}
+
+// readParams reads the parameters from the parameter file name, a Go
+// source file like pesto.go or a JSON file in the format of
+// [chester.EvalParams], along with all the game phase increments, the one
+// of the king, which isn't tuned, included.
+func readParams(name string) (params, [6]int, error) {
+	var w params
+	var phaseInc [6]int
+
+	if strings.HasSuffix(name, ".json") {
+		ep, err := chester.LoadEvalParams(name)
+		if err != nil {
+			return w, phaseInc, err
+		}
+		for piece := range 6 {
+			if piece < 5 {
+				w[mgValueIndex+piece] = float64(ep.MGValue[piece])
+				w[egValueIndex+piece] = float64(ep.EGValue[piece])
+			}
+			for sq := range 64 {
+				w[mgTableIndex+piece*64+sq] = float64(ep.MGTable[piece][sq])
+				w[egTableIndex+piece*64+sq] = float64(ep.EGTable[piece][sq])
+			}
+		}
+		loadPhaseInc(&w, ep.PhaseInc)
+		return w, ep.PhaseInc, nil
+	}
+
+	file, err := parser.ParseFile(token.NewFileSet(), name, nil, 0)
+	if err != nil {
+		return w, phaseInc, err
+	}
+
+	values := map[string][]int{}
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.VAR {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			vs := spec.(*ast.ValueSpec)
+			if len(vs.Values) != 1 {
+				continue
+			}
+			lit, ok := vs.Values[0].(*ast.CompositeLit)
+			if !ok {
+				continue
+			}
+			ints, err := intValues(lit)
+			if err != nil {
+				return w, phaseInc, fmt.Errorf("%s: %w", vs.Names[0].Name, err)
+			}
+			values[vs.Names[0].Name] = ints
+		}
+	}
+
+	load := func(name string, dst []float64) error {
+		ints, ok := values[name]
+		if !ok || len(ints) < len(dst) {
+			return fmt.Errorf("missing or short %s", name)
+		}
+		for i := range dst {
+			dst[i] = float64(ints[i])
+		}
+		return nil
+	}
+
+	loads := []struct {
+		name string
+		dst  []float64
+	}{
+		{"mgValue", w[mgValueIndex:egValueIndex]},
+		{"egValue", w[egValueIndex:mgTableIndex]},
+	}
+	for piece, pieceName := range pieceNames {
+		loads = append(loads,
+			struct {
+				name string
+				dst  []float64
+			}{"mg" + pieceName + "Table", w[mgTableIndex+piece*64 : mgTableIndex+(piece+1)*64]},
+			struct {
+				name string
+				dst  []float64
+			}{"eg" + pieceName + "Table", w[egTableIndex+piece*64 : egTableIndex+(piece+1)*64]},
+		)
+	}
+	for _, l := range loads {
+		if err := load(l.name, l.dst); err != nil {
+			return w, phaseInc, err
+		}
+	}
+
+	inc, ok := values["gamephaseInc"]
+	if !ok || len(inc) != 6 {
+		return w, phaseInc, fmt.Errorf("missing gamephaseInc")
+	}
+	copy(phaseInc[:], inc)
+	loadPhaseInc(&w, phaseInc)
+	return w, phaseInc, nil
+}
+
+// loadPhaseInc sets the phase increments of w, but the king's, to phaseInc.
+func loadPhaseInc(w *params, phaseInc [6]int) {
+	for piece := range 5 {
+		w[phaseIndex+piece] = float64(phaseInc[piece])
+	}
+}
+
+// tunedPhaseInc returns the phase increments of w rounded, with the one of
+// the king from phaseInc.
+func tunedPhaseInc(w *params, phaseInc [6]int) [6]int {
+	for piece := range 5 {
+		phaseInc[piece] = int(math.Round(w[phaseIndex+piece]))
+	}
+	return phaseInc
+}
+
+// intValues returns the integers of a composite literal.
+func intValues(lit *ast.CompositeLit) ([]int, error) {
+	var ints []int
+	for _, elt := range lit.Elts {
+		sign := 1
+		if unary, ok := elt.(*ast.UnaryExpr); ok && unary.Op == token.SUB {
+			sign, elt = -1, unary.X
+		}
+		basic, ok := elt.(*ast.BasicLit)
+		if !ok || basic.Kind != token.INT {
+			return nil, fmt.Errorf("not an integer: %T", elt)
+		}
+		n, err := strconv.Atoi(basic.Value)
+		if err != nil {
+			return nil, err
+		}
+		ints = append(ints, sign*n)
+	}
+	return ints, nil
+}
+
+// writeParams writes the parameter file name, Go source or JSON depending
+// on its extension, with the parameters rounded to integers. The phase
+// increment of the king is taken from phaseInc.
+func writeParams(name string, w *params, phaseInc [6]int) error {
+	buf := new(bytes.Buffer)
+	phaseInc = tunedPhaseInc(w, phaseInc)
+
+	if strings.HasSuffix(name, ".json") {
+		ep := &chester.EvalParams{PhaseInc: phaseInc}
+		for piece := range 6 {
+			if piece < 5 {
+				ep.MGValue[piece] = int(math.Round(w[mgValueIndex+piece]))
+				ep.EGValue[piece] = int(math.Round(w[egValueIndex+piece]))
+			}
+			for sq := range 64 {
+				ep.MGTable[piece][sq] = int(math.Round(w[mgTableIndex+piece*64+sq]))
+				ep.EGTable[piece][sq] = int(math.Round(w[egTableIndex+piece*64+sq]))
+			}
+		}
+		ep.WriteTo(buf)
+		return os.WriteFile(name, buf.Bytes(), 0o644)
+	}
+
+	generatePreamble(buf)
+	generateValues(buf, "mgValue", w[mgValueIndex:egValueIndex])
+	generateValues(buf, "egValue", w[egValueIndex:mgTableIndex])
+	for piece, pieceName := range pieceNames {
+		generateTable(buf, "mg"+pieceName+"Table", w[mgTableIndex+piece*64:mgTableIndex+(piece+1)*64])
+		generateTable(buf, "eg"+pieceName+"Table", w[egTableIndex+piece*64:egTableIndex+(piece+1)*64])
+	}
+	fmt.Fprintf(buf, "var gamephaseInc = [6]int{%d, %d, %d, %d, %d, %d}\n", phaseInc[0], phaseInc[1], phaseInc[2], phaseInc[3], phaseInc[4], phaseInc[5])
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("error formatting source: %v\n%s", err, buf.String())
+	}
+	return os.WriteFile(name, src, 0o644)
+}
+
+func generatePreamble(w io.Writer) {
+	fmt.Fprintf(w, "// Code generated by internal/cmd/tune. DO NOT EDIT.\n\n")
+	fmt.Fprintf(w, "package %s\n\n", packageName)
+}
+
+func generateValues(w io.Writer, name string, values []float64) {
+	fmt.Fprintf(w, "var %s = [Piece(6)]int{", name)
+	for _, v := range values {
+		fmt.Fprintf(w, "%d, ", int(math.Round(v)))
+	}
+	fmt.Fprintf(w, "0}\n\n")
+}
+
+func generateTable(w io.Writer, name string, values []float64) {
+	fmt.Fprintf(w, "var %s = [64]int{\n", name)
+	for rank := range 8 {
+		fmt.Fprintf(w, "\t")
+		for file := range 8 {
+			if file > 0 {
+				fmt.Fprintf(w, " ")
+			}
+			fmt.Fprintf(w, "%d,", int(math.Round(values[rank*8+file])))
+		}
+		fmt.Fprintf(w, "\n")
+	}
+	fmt.Fprintf(w, "}\n\n")
+}
@@ -0,0 +1,187 @@
+package chester
+
+import "sync"
+
+// The KPK bitbase holds one bit per position of king and pawn against
+// king, set when the side with the pawn wins. Positions are normalized so
+// the pawn is white and stands on files a to d, which leaves 2 sides to
+// move, 64 squares per king and 24 pawn squares.
+const kpkSize = 2 * 64 * 64 * 24
+
+// kpkResult is the classification of a position while the bitbase is
+// built. Results are bit flags so the results of the successors can be
+// combined with a bitwise or.
+type kpkResult uint8
+
+const (
+	kpkInvalid kpkResult = 0
+	kpkUnknown kpkResult = 1
+	kpkDraw    kpkResult = 2
+	kpkWin     kpkResult = 4
+)
+
+// kpkBitbase is the KPK bitbase, built on first use.
+var kpkBitbase = sync.OnceValue(generateKPK)
+
+// kpkIndex returns the index in the bitbase of the position with stm to
+// move, the black king on bk, the white king on wk and the white pawn on
+// pawn, which must be on files a to d and ranks 2 to 7.
+func kpkIndex(stm Color, bk, wk, pawn Square) int {
+	rank, file := pawn.RankAndFile()
+	return int(stm) | int(bk)<<1 | int(wk)<<7 | (int(file)+4*int(rank-1))<<13
+}
+
+// ProbeKPK reports whether the side with the pawn wins the king and pawn
+// against king position p, with best play and no fifty-move rule. It
+// returns false if p isn't such a position.
+func ProbeKPK(p *Position) (win bool) {
+	if !isKPK(p) {
+		return false
+	}
+
+	strong := White
+	if p.pieces[Pawn]&p.allPieces[Black] != 0 {
+		strong = Black
+	}
+
+	wk, bk := kingSquare(p, strong), kingSquare(p, strong^1)
+	pawn, _ := p.pieces[Pawn].PopLSB()
+	stm := White
+	if p.active != strong {
+		stm = Black
+	}
+
+	// flip the board so the pawn is white and mirror it to the a-d files
+	if strong == Black {
+		wk, bk, pawn = wk^56, bk^56, pawn^56
+	}
+	if pawn.File() > 3 {
+		wk, bk, pawn = wk^7, bk^7, pawn^7
+	}
+
+	bits := kpkBitbase()
+	index := kpkIndex(stm, bk, wk, pawn)
+	return bits[index/64]&(1<<(index%64)) != 0
+}
+
+// isKPK reports whether p is a king and pawn against king position.
+func isKPK(p *Position) bool {
+	return p.pieces[Pawn].OnesCount() == 1 && p.Occupied().OnesCount() == 3
+}
+
+// generateKPK builds the KPK bitbase by retrograde analysis: positions
+// that are immediately won or drawn are classified first, then the rest
+// are repeatedly classified from their successors until nothing changes.
+func generateKPK() []uint64 {
+	db := make([]kpkResult, kpkSize)
+	for index := range db {
+		db[index] = kpkClassifyInitial(index)
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for index, result := range db {
+			if result == kpkUnknown {
+				if db[index] = kpkClassify(db, index); db[index] != kpkUnknown {
+					changed = true
+				}
+			}
+		}
+	}
+
+	bits := make([]uint64, kpkSize/64)
+	for index, result := range db {
+		if result == kpkWin {
+			bits[index/64] |= 1 << (index % 64)
+		}
+	}
+	return bits
+}
+
+// kpkDecode returns the position encoded by index.
+func kpkDecode(index int) (stm Color, bk, wk, pawn Square) {
+	stm = Color(index & 1)
+	bk = Square(index >> 1 & 63)
+	wk = Square(index >> 7 & 63)
+	p := index >> 13
+	pawn = SquareFromRankAndFile(int8(p/4+1), int8(p%4))
+	return stm, bk, wk, pawn
+}
+
+// kpkClassifyInitial classifies the position encoded by index without
+// looking at its successors.
+func kpkClassifyInitial(index int) kpkResult {
+	stm, bk, wk, pawn := kpkDecode(index)
+	pawnBB := NewBitboardFromSquare(pawn)
+	attacks := pawnAttacks(White, pawnBB)
+	push := pawn - 8
+
+	switch {
+	// overlapping or adjacent kings, a king on the pawn or black in check
+	// with white to move
+	case squareDistance(wk, bk) <= 1 || wk == pawn || bk == pawn:
+		return kpkInvalid
+	case stm == White && attacks&NewBitboardFromSquare(bk) != 0:
+		return kpkInvalid
+
+	// the pawn promotes and the queen can't be captured
+	case stm == White && pawn.Rank() == 6 && wk != push && bk != push &&
+		(squareDistance(bk, push) > 1 || squareDistance(wk, push) == 1):
+		return kpkWin
+
+	// stalemate or the pawn is captured
+	case stm == Black && kingMoves[bk]&^(kingMoves[wk]|attacks) == 0:
+		return kpkDraw
+	case stm == Black && kingMoves[bk]&^kingMoves[wk]&pawnBB != 0:
+		return kpkDraw
+	}
+
+	return kpkUnknown
+}
+
+// kpkClassify classifies the position encoded by index from the results of
+// its successors: white wins if a move reaches a win, black draws if a
+// move reaches a draw.
+func kpkClassify(db []kpkResult, index int) kpkResult {
+	stm, bk, wk, pawn := kpkDecode(index)
+
+	good, bad := kpkWin, kpkDraw
+	if stm == Black {
+		good, bad = kpkDraw, kpkWin
+	}
+
+	result := kpkInvalid
+	if stm == White {
+		bb := kingMoves[wk]
+		for bb != 0 {
+			var sq Square
+			sq, bb = bb.PopLSB()
+			result |= db[kpkIndex(Black, bk, sq, pawn)]
+		}
+
+		// a push to the last rank is classified on the initial pass
+		push := pawn - 8
+		if pawn.Rank() < 6 {
+			result |= db[kpkIndex(Black, bk, wk, push)]
+		}
+		if pawn.Rank() == 1 && push != wk && push != bk {
+			result |= db[kpkIndex(Black, bk, wk, push-8)]
+		}
+	} else {
+		bb := kingMoves[bk]
+		for bb != 0 {
+			var sq Square
+			sq, bb = bb.PopLSB()
+			result |= db[kpkIndex(White, sq, wk, pawn)]
+		}
+	}
+
+	switch {
+	case result&good != 0:
+		return good
+	case result&kpkUnknown != 0:
+		return kpkUnknown
+	default:
+		return bad
+	}
+}
@@ -0,0 +1,180 @@
+package chester_test
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/bluescreen10/chester"
+)
+
+func TestProbeKPK(t *testing.T) {
+	tests := []struct {
+		fen string
+		win bool
+	}{
+		{"8/8/8/8/8/4k3/4P3/4K3 w - - 0 1", false},
+		{"8/8/8/8/8/4k3/4P3/4K3 b - - 0 1", false},
+		{"4k3/8/4K3/4P3/8/8/8/8 w - - 0 1", true},
+		{"4k3/8/4K3/4P3/8/8/8/8 b - - 0 1", true},
+		{"4k3/8/8/4K3/4P3/8/8/8 w - - 0 1", true},
+		{"4k3/8/8/4K3/4P3/8/8/8 b - - 0 1", false},
+		{"k7/8/K7/P7/8/8/8/8 w - - 0 1", false},
+		{"8/8/8/8/8/8/P6k/K7 w - - 0 1", true},
+		{"8/8/8/8/8/8/P6k/K7 b - - 0 1", true},
+		{"8/8/8/4k3/8/8/1P6/4K3 w - - 0 1", false},
+		{"8/8/8/8/8/8/4P3/4K3 w - - 0 1", false},
+		{"8/8/8/8/8/8/8/4KQ2 w - - 0 1", false},
+	}
+
+	for _, test := range tests {
+		for _, fen := range []string{test.fen, mirrorFEN(test.fen), flipFilesFEN(test.fen)} {
+			p, err := chester.ParseFEN(fen)
+			if err != nil {
+				continue
+			}
+			if got := chester.ProbeKPK(p); got != test.win {
+				t.Errorf("%s: got win %v, want %v", fen, got, test.win)
+			}
+		}
+	}
+}
+
+// TestProbeKPK_Consistency checks the bitbase against the moves of random
+// positions: the side with the pawn wins if one of its moves wins, the
+// defending side loses if all its moves lose.
+func TestProbeKPK_Consistency(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	for checked := 0; checked < 2000; {
+		var board [64]byte
+		wk, bk, pawn := r.Intn(64), r.Intn(64), 8+r.Intn(48)
+		if wk == bk || wk == pawn || bk == pawn {
+			continue
+		}
+		board[wk], board[bk], board[pawn] = 'K', 'k', 'P'
+
+		active := "w"
+		if r.Intn(2) == 0 {
+			active = "b"
+		}
+
+		p, err := chester.ParseFEN(boardFEN(board) + " " + active + " - - 0 1")
+		if err != nil || !validKPK(p) {
+			continue
+		}
+		checked++
+
+		moves, _ := chester.LegalMoves(nil, p)
+		strong := active == "w"
+		want := !strong
+		for _, m := range moves {
+			child := *p
+			child.Do(m)
+			win := chester.ProbeKPK(&child)
+			if strong && win {
+				want = true
+			}
+			if !strong && !win {
+				want = false
+			}
+		}
+
+		if got := chester.ProbeKPK(p); got != want {
+			t.Fatalf("%s: got win %v, want %v from the moves", p.FEN(), got, want)
+		}
+	}
+}
+
+func TestSearch_KPK(t *testing.T) {
+	tests := []struct {
+		fen string
+		win bool
+	}{
+		{"8/8/8/8/8/8/P6k/K7 w - - 0 1", true},
+		{"8/8/8/4k3/8/8/1P6/4K3 w - - 0 1", false},
+		{"4k3/8/8/4K3/4P3/8/8/8 w - - 0 1", true},
+	}
+
+	for _, test := range tests {
+		p, _ := chester.ParseFEN(test.fen)
+		best, err := chester.Search(context.Background(), p, chester.SearchOptions{MaxDepth: 4}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if win := best.Score > 5000; win != test.win {
+			t.Errorf("%s: got score %d, want win %v", test.fen, best.Score, test.win)
+		}
+
+		// the best move keeps the result
+		p.Do(best.Best)
+		if got := chester.ProbeKPK(p); got != test.win {
+			t.Errorf("%s: %s changed the result", test.fen, best.Best)
+		}
+	}
+}
+
+// validKPK reports whether p is a legal king and pawn against king
+// position whose pawn can't promote on the next move.
+func validKPK(p *chester.Position) bool {
+	wk, _ := p.WhiteKing().PopLSB()
+	bk, _ := p.BlackKing().PopLSB()
+	pawn, _ := p.WhitePawns().PopLSB()
+
+	wr, wf := wk.RankAndFile()
+	br, bf := bk.RankAndFile()
+	if max(wr-br, br-wr, wf-bf, bf-wf) <= 1 {
+		return false
+	}
+
+	// the black king can't be in check with white to move
+	pr, pf := pawn.RankAndFile()
+	checked := br == pr+1 && (bf == pf-1 || bf == pf+1)
+	return pr >= 1 && pr <= 5 && !(checked && p.Active() == chester.White)
+}
+
+// boardFEN returns the piece placement field of a FEN for board, indexed
+// from a8 to h1.
+func boardFEN(board [64]byte) string {
+	var sb strings.Builder
+	for rank := range 8 {
+		empty := 0
+		for file := range 8 {
+			if c := board[rank*8+file]; c != 0 {
+				if empty > 0 {
+					fmt.Fprint(&sb, empty)
+					empty = 0
+				}
+				sb.WriteByte(c)
+			} else {
+				empty++
+			}
+		}
+		if empty > 0 {
+			fmt.Fprint(&sb, empty)
+		}
+		if rank < 7 {
+			sb.WriteByte('/')
+		}
+	}
+	return sb.String()
+}
+
+// flipFilesFEN returns the FEN of the position mirrored from the a-file to
+// the h-file, which has the same result without castling rights.
+func flipFilesFEN(fen string) string {
+	parts := strings.Fields(fen)
+	ranks := strings.Split(parts[0], "/")
+	for i, rank := range ranks {
+		b := []byte(rank)
+		for l, r := 0, len(b)-1; l < r; l, r = l+1, r-1 {
+			b[l], b[r] = b[r], b[l]
+		}
+		ranks[i] = string(b)
+	}
+	parts[0] = strings.Join(ranks, "/")
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,297 @@
+package chester
+
+import (
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// ScaleNormal is the scale factor of an endgame evaluated at face value.
+// Smaller factors scale the endgame score down towards a draw.
+const ScaleNormal = 64
+
+// defaultMaterialTableSize is the size in bytes of the material table
+// used by [EvalPesto].
+const defaultMaterialTableSize = 256 * 1024
+
+// Scale factors of the endgames the material table knows about.
+const (
+	// oppositeBishopsScale applies to endings with bishops of opposite
+	// colors and pawns only, oppositeBishopsPiecesScale when other pieces
+	// are left too.
+	oppositeBishopsScale       = 22
+	oppositeBishopsPiecesScale = 46
+
+	// rookOneWingScale applies to rook endings with all the pawns on one
+	// wing and at most one extra pawn.
+	rookOneWingScale = 32
+)
+
+// Material imbalance weights, per piece and per own pawn above or below
+// five (Kaufman).
+var (
+	knightPawnAdjust = evalScore{3, 3}
+	rookPawnAdjust   = evalScore{-6, -6}
+	rookPairPenalty  = evalScore{-8, -16}
+)
+
+// scaleFunc returns the scale factor of the endgame of p when strong is
+// the side ahead.
+type scaleFunc func(p *Position, strong Color) int
+
+// MaterialEntry holds the evaluation data that only depends on the
+// material of a position. See [MaterialTable].
+type MaterialEntry struct {
+	key uint64
+
+	// Phase is the game phase, from 24 in the opening to 0 when only kings
+	// and pawns are left.
+	Phase int
+
+	// imbalance is the material imbalance adjustment from White's point
+	// of view.
+	imbalance evalScore
+
+	// scale holds the scale function of the endgame when each color is
+	// the side ahead, nil when it is evaluated at face value.
+	scale [Color(2)]scaleFunc
+
+	// endgame is the specialized evaluation of the endgame, if any.
+	endgame endgame
+}
+
+// Imbalance returns the midgame and endgame adjustment, from White's
+// point of view, for the material imbalance: knights gain value and rooks
+// lose it as pawns are added, and a pair of rooks is redundant.
+func (e *MaterialEntry) Imbalance() (mg, eg int) {
+	return e.imbalance.mg, e.imbalance.eg
+}
+
+// Scale returns the factor, out of [ScaleNormal], to apply to the endgame
+// score of p when strong is the side ahead. Drawish endings, like those
+// with bishops of opposite colors, are scaled down.
+func (e *MaterialEntry) Scale(p *Position, strong Color) int {
+	if e.scale[strong] == nil {
+		return ScaleNormal
+	}
+	return e.scale[strong](p, strong)
+}
+
+// Endgame evaluates p with the specialized evaluation of its material,
+// like the mates with queen, rook or bishop and knight against a bare
+// king. It reports false if there's none. The score is from the side to
+// move perspective.
+func (e *MaterialEntry) Endgame(p *Position) (score int, ok bool) {
+	if e.endgame.fn == nil {
+		return 0, false
+	}
+
+	score = e.endgame.fn(p, e.endgame.strong)
+	if p.active != e.endgame.strong {
+		score = -score
+	}
+	return score, true
+}
+
+// MaterialTable caches the material evaluation of positions by their
+// [Position.MaterialHash]: the game phase, the imbalance and the endgame
+// scale factors.
+//
+// Entries are immutable once stored and the slots are read and written
+// atomically, so a MaterialTable can be shared by several search threads
+// without locking. Custom [EvalFunc]s can keep their own table and use the
+// entries it returns.
+type MaterialTable struct {
+	slots []atomic.Pointer[MaterialEntry]
+	mask  uint64
+}
+
+// NewMaterialTable creates a material table with the given maximum size in
+// bytes. The number of entries is rounded down to a power of two.
+func NewMaterialTable(maxSize uint64) *MaterialTable {
+	count := maxSize / uint64(unsafe.Sizeof(atomic.Pointer[MaterialEntry]{})+unsafe.Sizeof(MaterialEntry{}))
+
+	size := uint64(1)
+	for size*2 <= count {
+		size *= 2
+	}
+
+	return &MaterialTable{slots: make([]atomic.Pointer[MaterialEntry], size), mask: size - 1}
+}
+
+// Probe returns the entry for the material of p, computing and storing it
+// if it isn't in the table. The entry is shared and must not be modified.
+func (t *MaterialTable) Probe(p *Position) *MaterialEntry {
+	key := p.materialHash
+	slot := &t.slots[key&t.mask]
+
+	if entry := slot.Load(); entry != nil && entry.key == key {
+		return entry
+	}
+
+	entry := newMaterialEntry(p)
+	slot.Store(entry)
+	return entry
+}
+
+// Clear removes all the entries from the table. It must not be called while
+// a search is using the table.
+func (t *MaterialTable) Clear() {
+	for i := range t.slots {
+		t.slots[i].Store(nil)
+	}
+}
+
+// pestoMaterialTable is the material table shared by every PeSTO
+// evaluation, allocated on first use.
+var pestoMaterialTable = sync.OnceValue(func() *MaterialTable {
+	return NewMaterialTable(defaultMaterialTableSize)
+})
+
+// newMaterialEntry computes the material entry of p.
+func newMaterialEntry(p *Position) *MaterialEntry {
+	entry := &MaterialEntry{key: p.materialHash}
+
+	var count [Color(2)][Piece(6)]int
+	for color := range Color(2) {
+		for piece := Pawn; piece <= Queen; piece++ {
+			count[color][piece] = (p.pieces[piece] & p.allPieces[color]).OnesCount()
+			entry.Phase += count[color][piece] * gamephaseInc[piece]
+		}
+	}
+	entry.Phase = min(entry.Phase, 24)
+
+	for color := range Color(2) {
+		var s evalScore
+		pawns := count[color][Pawn] - 5
+		s.mg += count[color][Knight] * pawns * knightPawnAdjust.mg
+		s.eg += count[color][Knight] * pawns * knightPawnAdjust.eg
+		s.mg += count[color][Rook] * pawns * rookPawnAdjust.mg
+		s.eg += count[color][Rook] * pawns * rookPawnAdjust.eg
+		if count[color][Rook] >= 2 {
+			s.mg += rookPairPenalty.mg
+			s.eg += rookPairPenalty.eg
+		}
+
+		if color == White {
+			entry.imbalance.mg += s.mg
+			entry.imbalance.eg += s.eg
+		} else {
+			entry.imbalance.mg -= s.mg
+			entry.imbalance.eg -= s.eg
+		}
+	}
+
+	// pieces counts the knights, bishops, rooks and queens of color, but
+	// those of type except
+	pieces := func(color Color, except Piece) int {
+		n := 0
+		for piece := Knight; piece <= Queen; piece++ {
+			if piece != except {
+				n += count[color][piece]
+			}
+		}
+		return n
+	}
+
+	if count[White][Bishop] == 1 && count[Black][Bishop] == 1 {
+		entry.scale = [Color(2)]scaleFunc{scaleOppositeBishops, scaleOppositeBishops}
+	}
+
+	if count[White][Rook] == 1 && count[Black][Rook] == 1 &&
+		pieces(White, Rook) == 0 && pieces(Black, Rook) == 0 {
+		entry.scale = [Color(2)]scaleFunc{scaleRookOneWing, scaleRookOneWing}
+	}
+
+	for strong := range Color(2) {
+		weak := strong ^ 1
+		if count[strong][Bishop] == 1 && pieces(strong, Bishop) == 0 && count[strong][Pawn] > 0 &&
+			pieces(weak, Empty) == 0 && count[weak][Pawn] == 0 {
+			entry.scale[strong] = scaleWrongRookPawn
+		}
+	}
+
+	if known, ok := endgameEvals[p.materialHash]; ok {
+		entry.endgame = known
+	}
+
+	return entry
+}
+
+// isLightSquare reports whether sq is a light square.
+func isLightSquare(sq Square) bool {
+	rank, file := sq.RankAndFile()
+	return (rank+file)%2 == 1
+}
+
+// squareDistance returns the number of king moves between two squares.
+func squareDistance(a, b Square) int {
+	rankA, fileA := a.RankAndFile()
+	rankB, fileB := b.RankAndFile()
+	ranks, files := int(rankA-rankB), int(fileA-fileB)
+	return max(ranks, -ranks, files, -files)
+}
+
+// scaleOppositeBishops scales down endings where each side has a single
+// bishop and they move on squares of different colors.
+func scaleOppositeBishops(p *Position, strong Color) int {
+	white, _ := (p.pieces[Bishop] & p.allPieces[White]).PopLSB()
+	black, _ := (p.pieces[Bishop] & p.allPieces[Black]).PopLSB()
+	if isLightSquare(white) == isLightSquare(black) {
+		return ScaleNormal
+	}
+
+	if p.pieces[Knight]|p.pieces[Rook]|p.pieces[Queen] == 0 {
+		return oppositeBishopsScale
+	}
+	return oppositeBishopsPiecesScale
+}
+
+// scaleRookOneWing scales down rook endings where all the pawns are on
+// the same wing and the strong side has at most one extra pawn.
+func scaleRookOneWing(p *Position, strong Color) int {
+	pawns := p.pieces[Pawn]
+	strongPawns := (pawns & p.allPieces[strong]).OnesCount()
+	weakPawns := (pawns & p.allPieces[strong^1]).OnesCount()
+	if strongPawns == 0 || strongPawns-weakPawns > 1 {
+		return ScaleNormal
+	}
+
+	queenSide := fileMask[0] | fileMask[1] | fileMask[2] | fileMask[3]
+	if pawns&queenSide != 0 && pawns&^queenSide != 0 {
+		return ScaleNormal
+	}
+	return rookOneWingScale
+}
+
+// scaleWrongRookPawn recognizes the draw of a bishop and pawns on a single
+// rook file against a bare king, when the bishop doesn't control the
+// promotion square and the defending king reaches it.
+func scaleWrongRookPawn(p *Position, strong Color) int {
+	pawns := p.pieces[Pawn] & p.allPieces[strong]
+	file := 0
+	switch {
+	case pawns&^fileMask[0] == 0:
+	case pawns&^fileMask[7] == 0:
+		file = 7
+	default:
+		return ScaleNormal
+	}
+
+	rank := int8(7)
+	if strong == Black {
+		rank = 0
+	}
+	queening := SquareFromRankAndFile(rank, int8(file))
+
+	bishop, _ := (p.pieces[Bishop] & p.allPieces[strong]).PopLSB()
+	if isLightSquare(bishop) == isLightSquare(queening) {
+		return ScaleNormal
+	}
+
+	king, _ := (p.pieces[King] & p.allPieces[strong^1]).PopLSB()
+	if squareDistance(king, queening) > 1 {
+		return ScaleNormal
+	}
+	return 0
+}
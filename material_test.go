@@ -0,0 +1,147 @@
+package chester_test
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/bluescreen10/chester"
+)
+
+func TestMaterialHash(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	for range 50 {
+		p, _ := chester.ParseFEN(chester.DefaultFEN)
+
+		for range 200 {
+			var moves []chester.Move
+			moves, _ = chester.LegalMoves(moves, p)
+			if len(moves) == 0 {
+				break
+			}
+
+			before := *p
+			m := moves[r.Intn(len(moves))]
+			p.Do(m)
+
+			want, err := chester.ParseFEN(p.FEN())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := p.MaterialHash(); got != want.MaterialHash() {
+				t.Fatalf("%s: Do(%s) got material hash %x, want %x", before.FEN(), m, got, want.MaterialHash())
+			}
+
+			captured := p.Occupied().OnesCount() != before.Occupied().OnesCount()
+			if !captured && !m.IsPromotion() && p.MaterialHash() != before.MaterialHash() {
+				t.Fatalf("%s: Do(%s) changed the material hash", before.FEN(), m)
+			}
+		}
+	}
+
+	a, _ := chester.ParseFEN("4k3/8/8/3n4/8/8/3PP3/4K3 w - - 0 1")
+	b, _ := chester.ParseFEN("1n6/8/8/8/6k1/8/PP6/7K b - - 0 1")
+	if a.MaterialHash() != b.MaterialHash() {
+		t.Errorf("got different material hashes for the same material")
+	}
+}
+
+func TestMaterialTable(t *testing.T) {
+	tests := []struct {
+		name   string
+		fen    string
+		strong chester.Color
+		phase  int
+		scale  int
+	}{
+		{"start position", chester.DefaultFEN, chester.White, 24, chester.ScaleNormal},
+		{"opposite bishops", "4k1b1/5ppp/8/8/8/8/4PPPP/2B1K3 w - - 0 1", chester.White, 2, 22},
+		{"same colored bishops", "4kb2/5ppp/8/8/8/8/4PPPP/2B1K3 w - - 0 1", chester.White, 2, chester.ScaleNormal},
+		{"opposite bishops and knights", "4k1b1/5ppp/4n3/8/8/4N3/4PPPP/2B1K3 w - - 0 1", chester.White, 4, 46},
+		{"rook ending on one wing", "r3k3/5ppp/8/8/8/8/4PPPP/4K2R w - - 0 1", chester.White, 4, 32},
+		{"rook ending on both wings", "r3k3/p4ppp/8/8/8/8/P3PPPP/4K2R w - - 0 1", chester.White, 4, chester.ScaleNormal},
+		{"rook ending two pawns up", "r3k3/6pp/8/8/8/8/4PPPP/4K2R w - - 0 1", chester.White, 4, chester.ScaleNormal},
+		{"wrong rook pawn", "8/1k6/8/P7/8/8/8/2B1K3 w - - 0 1", chester.White, 1, 0},
+		{"wrong rook pawn far king", "7k/8/8/P7/8/8/8/2B1K3 w - - 0 1", chester.White, 1, chester.ScaleNormal},
+		{"right rook pawn", "8/1k6/8/P7/8/8/8/3BK3 w - - 0 1", chester.White, 1, chester.ScaleNormal},
+		{"wrong rook pawn black", "3bk3/8/8/8/7p/8/6K1/8 w - - 0 1", chester.Black, 1, 0},
+	}
+
+	table := chester.NewMaterialTable(64 * 1024)
+
+	for _, test := range tests {
+		p, err := chester.ParseFEN(test.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		entry := table.Probe(p)
+		if entry.Phase != test.phase {
+			t.Errorf("%s: got phase %d, want %d", test.name, entry.Phase, test.phase)
+		}
+		if got := entry.Scale(p, test.strong); got != test.scale {
+			t.Errorf("%s: got scale %d, want %d", test.name, got, test.scale)
+		}
+	}
+}
+
+func TestMaterialTable_Imbalance(t *testing.T) {
+	// a knight gains value with every pawn above five
+	p, _ := chester.ParseFEN("4k3/pppppppp/8/8/8/8/PPPPPPPP/1N2K3 w - - 0 1")
+	entry := chester.NewMaterialTable(1024).Probe(p)
+	if mg, eg := entry.Imbalance(); mg != 9 || eg != 9 {
+		t.Errorf("got imbalance %d %d, want 9 9", mg, eg)
+	}
+
+	p, _ = chester.ParseFEN("1n2k3/pppppppp/8/8/8/8/PPPPPPPP/4K3 w - - 0 1")
+	entry = chester.NewMaterialTable(1024).Probe(p)
+	if mg, eg := entry.Imbalance(); mg != -9 || eg != -9 {
+		t.Errorf("got imbalance %d %d, want -9 -9", mg, eg)
+	}
+}
+
+func TestEvalPesto_Scale(t *testing.T) {
+	drawn, _ := chester.ParseFEN("8/1k6/8/P7/8/8/8/2B1K3 w - - 0 1")
+	won, _ := chester.ParseFEN("8/1k6/8/P7/8/8/8/3BK3 w - - 0 1")
+
+	if score := chester.EvalPesto(drawn); score < 0 || score > 50 {
+		t.Errorf("wrong rook pawn: got %d, want a drawish score", score)
+	}
+	if score := chester.EvalPesto(won); score < 300 {
+		t.Errorf("right rook pawn: got %d, want a winning score", score)
+	}
+}
+
+func TestMaterialTable_Concurrent(t *testing.T) {
+	fens := []string{
+		chester.DefaultFEN,
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+		"4k3/pppppppp/8/8/8/8/PPPPPPPP/1N2K3 w - - 0 1",
+	}
+
+	// a tiny table so the threads keep replacing each other's entries
+	table := chester.NewMaterialTable(1)
+
+	var wg sync.WaitGroup
+	for i := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 1000 {
+				fen := fens[(i+j)%len(fens)]
+				p, _ := chester.ParseFEN(fen)
+				want := chester.NewMaterialTable(1024).Probe(p)
+				got := table.Probe(p)
+				gotMG, gotEG := got.Imbalance()
+				wantMG, wantEG := want.Imbalance()
+				if got.Phase != want.Phase || gotMG != wantMG || gotEG != wantEG {
+					t.Errorf("%s: got a different entry from the shared table", fen)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
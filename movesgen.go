@@ -45,8 +45,10 @@ func LegalMoves(moves []Move, p *Position) ([]Move, bool) {
 	return legalMoves(moves, p, false)
 }
 
-// CaptureMoves appends all legal capture moves for the active color to moves.
-// It returns the updated slice and whether the king is in check.
+// CaptureMoves appends all legal capture and promotion moves for the active
+// color to moves. When the king is in check it also includes interpositions
+// on the checking ray. It returns the updated slice and whether the king is
+// in check.
 func CaptureMoves(moves []Move, p *Position) ([]Move, bool) {
 	return legalMoves(moves, p, true)
 }
@@ -72,6 +74,16 @@ func legalMoves(moves []Move, p *Position, captureOnly bool) ([]Move, bool) {
 	case 1:
 		if !captureOnly {
 			moves = genPawnForwardMoves(moves, p, cpm)
+		} else {
+			// quiet promotions are noisy enough to be considered
+			// alongside captures
+			promotions := cpm
+			if inCheck {
+				promotions.moveMask &= Rank_1 | Rank_8
+			} else {
+				promotions.moveMask = p.EnemiesOrEmpty() & (Rank_1 | Rank_8)
+			}
+			moves = genPawnForwardMoves(moves, p, promotions)
 		}
 		moves = genPawnLeftAttackMoves(moves, p, cpm)
 		moves = genPawnRightAttackMoves(moves, p, cpm)
@@ -716,6 +716,13 @@ func TestCaptureOnlyMoves(t *testing.T) {
 				"e6c4",
 			},
 		},
+
+		{
+			fen: "4k3/1P6/8/8/8/8/8/4K3 w - - 0 1",
+			expected: []string{
+				"b7b8b", "b7b8n", "b7b8q", "b7b8r",
+			},
+		},
 	}
 
 	for _, test := range tests {
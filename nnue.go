@@ -0,0 +1,517 @@
+package chester
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// FeatureSet selects the input features of a [Network]. In both sets a
+// feature is a piece on a square seen from one side, for every bucket of
+// the square of the king of that side.
+type FeatureSet uint32
+
+const (
+	// HalfKA has a feature for every piece, kings included: 768 features
+	// per king bucket.
+	HalfKA FeatureSet = iota
+
+	// HalfKP has a feature for every piece but the kings: 640 features
+	// per king bucket.
+	HalfKP
+)
+
+// nnueMagic and nnueVersion identify the network files.
+const (
+	nnueMagic   = "CHNN"
+	nnueVersion = 1
+)
+
+// Limits on the size of the networks read, so a corrupt file doesn't
+// allocate gigabytes.
+const (
+	maxNNUEWidth   = 4096
+	maxNNUELayers  = 8
+	maxNNUEBuckets = 64
+
+	// maxNNUEFeatureWeights bounds the feature transformer, 128MB of
+	// weights.
+	maxNNUEFeatureWeights = 64 << 20
+)
+
+// ErrInvalidNetwork is returned when reading a network that isn't valid.
+var ErrInvalidNetwork = errors.New("invalid network")
+
+// Network is a quantized efficiently updatable neural network (NNUE)
+// evaluating a position from the point of view of the side to move.
+//
+// A feature transformer turns the features of each side into an
+// accumulator of L1 int16 values, the sum of its bias and the weights of
+// the active features. The accumulators of the side to move and of the
+// other side, clipped to [0, 127], are the 2*L1 inputs of a stack of
+// dense layers with int8 weights and int32 biases. The output of a hidden
+// layer is its sum shifted right by 6 bits, the weights scale, and clipped
+// to [0, 127]. The last layer has a single output; the evaluation, in
+// centipawns, is that sum times Scale divided by 127*64, rounded towards
+// zero.
+//
+// Features are computed with the board seen from each side: squares are
+// numbered from a1 = 0 to h8 = 63 for white and flipped vertically for
+// black, so a8 = 0 for black. The index of a piece on sq is
+//
+//	KingBuckets[king]*n + (piece + k*other)*64 + sq
+//
+// where king is the square of the king of the side, piece is 0 to 5 from
+// the pawn to the king, other is 1 for the pieces of the other side, and
+// n and k are 768 and 6 with [HalfKA] and 640 and 5 with [HalfKP].
+//
+// Networks are stored in little endian, as read by [ReadNetwork]:
+//
+//	magic        [4]byte  "CHNN"
+//	version      uint32   1
+//	features     uint32   the FeatureSet
+//	buckets      [64]byte KingBuckets
+//	l1           uint32   accumulator size
+//	layers       uint32   number of dense layers
+//	outputs      [layers]uint32, the last one 1
+//	scale        int32
+//	bias         [l1]int16
+//	weights      [features][l1]int16
+//	then for each dense layer, with in inputs and out outputs:
+//	bias         [out]int32
+//	weights      [out][in]int8
+type Network struct {
+	Features FeatureSet
+
+	// KingBuckets maps the squares of the king to the set of features
+	// used, numbered from 0.
+	KingBuckets [64]uint8
+
+	// FeatureBias and FeatureWeights are the feature transformer, with the
+	// L1 weights of each feature one after the other.
+	FeatureBias    []int16
+	FeatureWeights []int16
+
+	// Layers are the dense layers, the first one has 2*L1 inputs and the
+	// last one a single output.
+	Layers []DenseLayer
+
+	// Scale converts the output of the network to centipawns.
+	Scale int32
+}
+
+// DenseLayer is a fully connected layer of a [Network].
+type DenseLayer struct {
+	Inputs, Outputs int
+
+	// Bias holds the bias of every output and Weights the weights of
+	// every output, one after the other.
+	Bias    []int32
+	Weights []int8
+}
+
+// LoadNetwork reads the network in the file name.
+func LoadNetwork(name string) (*Network, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadNetwork(bufio.NewReader(f))
+}
+
+// ReadNetwork reads a network in the format described in [Network].
+func ReadNetwork(r io.Reader) (*Network, error) {
+	var header struct {
+		Magic    [4]byte
+		Version  uint32
+		Features FeatureSet
+		Buckets  [64]uint8
+		L1       uint32
+		Layers   uint32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return nil, err
+	}
+
+	if string(header.Magic[:]) != nnueMagic || header.Version != nnueVersion {
+		return nil, fmt.Errorf("%w: not a network file", ErrInvalidNetwork)
+	}
+	if header.Features > HalfKP || header.L1 == 0 || header.L1 > maxNNUEWidth ||
+		header.Layers == 0 || header.Layers > maxNNUELayers {
+		return nil, fmt.Errorf("%w: bad header", ErrInvalidNetwork)
+	}
+
+	outputs := make([]uint32, header.Layers)
+	if err := binary.Read(r, binary.LittleEndian, outputs); err != nil {
+		return nil, err
+	}
+
+	n := &Network{Features: header.Features, KingBuckets: header.Buckets}
+	if err := binary.Read(r, binary.LittleEndian, &n.Scale); err != nil {
+		return nil, err
+	}
+
+	l1 := int(header.L1)
+	if n.bucketCount() > maxNNUEBuckets || n.featureCount()*l1 > maxNNUEFeatureWeights {
+		return nil, fmt.Errorf("%w: feature transformer too large", ErrInvalidNetwork)
+	}
+	n.FeatureBias = make([]int16, l1)
+	n.FeatureWeights = make([]int16, n.featureCount()*l1)
+
+	inputs := 2 * l1
+	for i, out := range outputs {
+		if out == 0 || out > maxNNUEWidth || i == len(outputs)-1 && out != 1 {
+			return nil, fmt.Errorf("%w: bad layer size", ErrInvalidNetwork)
+		}
+		n.Layers = append(n.Layers, DenseLayer{
+			Inputs:  inputs,
+			Outputs: int(out),
+			Bias:    make([]int32, out),
+			Weights: make([]int8, int(out)*inputs),
+		})
+		inputs = int(out)
+	}
+
+	values := []any{n.FeatureBias, n.FeatureWeights}
+	for _, layer := range n.Layers {
+		values = append(values, layer.Bias, layer.Weights)
+	}
+	for _, v := range values {
+		if err := binary.Read(r, binary.LittleEndian, v); err != nil {
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+// WriteTo writes n to w in the format read by [ReadNetwork].
+func (n *Network) WriteTo(w io.Writer) (int64, error) {
+	if err := n.validate(); err != nil {
+		return 0, err
+	}
+
+	outputs := make([]uint32, len(n.Layers))
+	for i, layer := range n.Layers {
+		outputs[i] = uint32(layer.Outputs)
+	}
+
+	cw := &countingWriter{w: w}
+	values := []any{
+		[]byte(nnueMagic), uint32(nnueVersion), n.Features, n.KingBuckets,
+		uint32(len(n.FeatureBias)), uint32(len(n.Layers)), outputs, n.Scale,
+		n.FeatureBias, n.FeatureWeights,
+	}
+	for _, layer := range n.Layers {
+		values = append(values, layer.Bias, layer.Weights)
+	}
+	for _, v := range values {
+		if err := binary.Write(cw, binary.LittleEndian, v); err != nil {
+			return cw.n, err
+		}
+	}
+	return cw.n, nil
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(b []byte) (int, error) {
+	n, err := cw.w.Write(b)
+	cw.n += int64(n)
+	return n, err
+}
+
+// validate checks that the sizes of the parts of n match.
+func (n *Network) validate() error {
+	l1 := len(n.FeatureBias)
+	if n.Features > HalfKP || l1 == 0 || len(n.FeatureWeights) != n.featureCount()*l1 || len(n.Layers) == 0 {
+		return fmt.Errorf("%w: bad feature transformer", ErrInvalidNetwork)
+	}
+
+	inputs := 2 * l1
+	for _, layer := range n.Layers {
+		if layer.Inputs != inputs || len(layer.Bias) != layer.Outputs || len(layer.Weights) != layer.Inputs*layer.Outputs {
+			return fmt.Errorf("%w: bad layer size", ErrInvalidNetwork)
+		}
+		inputs = layer.Outputs
+	}
+	if inputs != 1 {
+		return fmt.Errorf("%w: more than one output", ErrInvalidNetwork)
+	}
+	return nil
+}
+
+// featuresPerBucket returns the number of features of each king bucket.
+func (n *Network) featuresPerBucket() int {
+	if n.Features == HalfKP {
+		return 640
+	}
+	return 768
+}
+
+// bucketCount returns the number of king buckets of n.
+func (n *Network) bucketCount() int {
+	buckets := 0
+	for _, b := range n.KingBuckets {
+		buckets = max(buckets, int(b)+1)
+	}
+	return buckets
+}
+
+// featureCount returns the number of features of n.
+func (n *Network) featureCount() int {
+	return n.bucketCount() * n.featuresPerBucket()
+}
+
+// feature returns the index of piece of color on sq seen by side, whose
+// king is on king, or -1 if it isn't a feature.
+func (n *Network) feature(side Color, king Square, piece Piece, color Color, sq Square) int {
+	kinds := 6
+	if n.Features == HalfKP {
+		if piece == King {
+			return -1
+		}
+		kinds = 5
+	}
+
+	index := int(piece)
+	if color != side {
+		index += kinds
+	}
+	return int(n.KingBuckets[orientSquare(side, king)])*n.featuresPerBucket() + index*64 + int(orientSquare(side, sq))
+}
+
+// orientSquare returns sq numbered from a1 = 0 for white and from a8 = 0
+// for black.
+func orientSquare(side Color, sq Square) Square {
+	if side == White {
+		return sq ^ 56
+	}
+	return sq
+}
+
+// sameBucket reports whether the features of side are the same with its
+// king on a and on b.
+func (n *Network) sameBucket(side Color, a, b Square) bool {
+	return n.KingBuckets[orientSquare(side, a)] == n.KingBuckets[orientSquare(side, b)]
+}
+
+// Evaluate computes the accumulators of p from scratch and returns its
+// evaluation from the point of view of the side to move. The incremental
+// evaluator returned by [NewNNUEEvaluator] gives the same score faster.
+func (n *Network) Evaluate(p *Position) int {
+	var acc [Color(2)][]int16
+	for side := range Color(2) {
+		acc[side] = make([]int16, len(n.FeatureBias))
+		n.refresh(acc[side], side, p)
+	}
+	return n.forward(acc[p.active], acc[p.active^1], make([]int32, n.bufferSize()))
+}
+
+// refresh sets acc to the accumulator of side for p.
+func (n *Network) refresh(acc []int16, side Color, p *Position) {
+	copy(acc, n.FeatureBias)
+	king := kingSquare(p, side)
+	for color := range Color(2) {
+		for piece := Pawn; piece <= King; piece++ {
+			bb := p.pieces[piece] & p.allPieces[color]
+			for bb != 0 {
+				var sq Square
+				sq, bb = bb.PopLSB()
+				n.add(acc, n.feature(side, king, piece, color, sq))
+			}
+		}
+	}
+}
+
+// add adds the weights of feature to acc, unless feature is -1.
+func (n *Network) add(acc []int16, feature int) {
+	if feature < 0 {
+		return
+	}
+	weights := n.FeatureWeights[feature*len(acc) : (feature+1)*len(acc)]
+	for i, w := range weights {
+		acc[i] += w
+	}
+}
+
+// sub subtracts the weights of feature from acc, unless feature is -1.
+func (n *Network) sub(acc []int16, feature int) {
+	if feature < 0 {
+		return
+	}
+	weights := n.FeatureWeights[feature*len(acc) : (feature+1)*len(acc)]
+	for i, w := range weights {
+		acc[i] -= w
+	}
+}
+
+// bufferSize returns the size of the buffer of the activations of n.
+func (n *Network) bufferSize() int {
+	width := 2 * len(n.FeatureBias)
+	for _, layer := range n.Layers {
+		width = max(width, layer.Outputs)
+	}
+	return 2 * width
+}
+
+// forward runs the dense layers on the accumulators of the side to move
+// and the other side, using buf, of [Network.bufferSize] values, for the
+// activations, and returns the evaluation in centipawns.
+func (n *Network) forward(us, them []int16, buf []int32) int {
+	l1, width := len(us), len(buf)/2
+	a, b := buf[:width:width], buf[width:]
+
+	in := a[:2*l1]
+	for i, v := range us {
+		in[i] = min(max(int32(v), 0), 127)
+	}
+	for i, v := range them {
+		in[l1+i] = min(max(int32(v), 0), 127)
+	}
+
+	for l, layer := range n.Layers {
+		out := b[:layer.Outputs]
+		for o := range out {
+			sum := layer.Bias[o]
+			for i, w := range layer.Weights[o*layer.Inputs : (o+1)*layer.Inputs] {
+				sum += int32(w) * in[i]
+			}
+			if l < len(n.Layers)-1 {
+				sum = min(max(sum>>6, 0), 127)
+			}
+			out[o] = sum
+		}
+		in = out
+		a, b = b, a
+	}
+
+	score := int(int64(in[0]) * int64(n.Scale) / (127 * 64))
+	return min(max(score, -mateThreshold+1), mateThreshold-1)
+}
+
+// nnueState is the state of the incremental evaluator at one ply: the
+// accumulators and king squares of both sides. An accumulator is stale
+// after its king moved to another bucket and is computed again from the
+// position when it is evaluated.
+type nnueState struct {
+	acc   [Color(2)][]int16
+	king  [Color(2)]Square
+	stale [Color(2)]bool
+}
+
+// nnueEvaluator is the incremental evaluator of a [Network].
+type nnueEvaluator struct {
+	net   *Network
+	stack []nnueState
+	top   int
+	buf   []int32
+}
+
+// NewNNUEEvaluator returns an incremental evaluator computing the same
+// score as net.Evaluate, updating the accumulators as pieces move.
+func NewNNUEEvaluator(net *Network) IncrementalEvaluator {
+	return &nnueEvaluator{net: net, buf: make([]int32, net.bufferSize())}
+}
+
+// state returns the state of the current ply.
+func (e *nnueEvaluator) state() *nnueState {
+	return &e.stack[e.top]
+}
+
+func (e *nnueEvaluator) Evaluate(p *Position) int {
+	s := e.state()
+	for side := range Color(2) {
+		if s.stale[side] {
+			e.net.refresh(s.acc[side], side, p)
+			s.stale[side] = false
+		}
+	}
+	return e.net.forward(s.acc[p.active], s.acc[p.active^1], e.buf)
+}
+
+func (e *nnueEvaluator) PieceAdded(piece Piece, color Color, sq Square) {
+	s := e.state()
+	for side := range Color(2) {
+		if piece == King && color == side {
+			s.king[side], s.stale[side] = sq, true
+		}
+		if !s.stale[side] {
+			e.net.add(s.acc[side], e.net.feature(side, s.king[side], piece, color, sq))
+		}
+	}
+}
+
+func (e *nnueEvaluator) PieceRemoved(piece Piece, color Color, sq Square) {
+	s := e.state()
+	for side := range Color(2) {
+		if !s.stale[side] {
+			e.net.sub(s.acc[side], e.net.feature(side, s.king[side], piece, color, sq))
+		}
+	}
+}
+
+func (e *nnueEvaluator) PieceMoved(piece Piece, color Color, from, to Square) {
+	s := e.state()
+	for side := range Color(2) {
+		if piece == King && color == side {
+			s.king[side] = to
+			if !e.net.sameBucket(side, from, to) {
+				s.stale[side] = true
+			}
+		}
+		if !s.stale[side] {
+			e.net.sub(s.acc[side], e.net.feature(side, s.king[side], piece, color, from))
+			e.net.add(s.acc[side], e.net.feature(side, s.king[side], piece, color, to))
+		}
+	}
+}
+
+func (e *nnueEvaluator) Reset(p *Position) {
+	e.top = 0
+	if len(e.stack) == 0 {
+		e.grow()
+	}
+
+	s := e.state()
+	for side := range Color(2) {
+		s.king[side] = kingSquare(p, side)
+		s.stale[side] = false
+		e.net.refresh(s.acc[side], side, p)
+	}
+}
+
+// grow adds a state to the stack.
+func (e *nnueEvaluator) grow() {
+	l1 := len(e.net.FeatureBias)
+	acc := make([]int16, 2*l1)
+	e.stack = append(e.stack, nnueState{acc: [Color(2)][]int16{acc[:l1], acc[l1:]}})
+}
+
+func (e *nnueEvaluator) Push() {
+	if e.top+1 == len(e.stack) {
+		e.grow()
+	}
+
+	s, next := &e.stack[e.top], &e.stack[e.top+1]
+	for side := range Color(2) {
+		copy(next.acc[side], s.acc[side])
+	}
+	next.king, next.stale = s.king, s.stale
+	e.top++
+}
+
+func (e *nnueEvaluator) Pop() {
+	e.top--
+}
+
+func (e *nnueEvaluator) Clone() IncrementalEvaluator {
+	return NewNNUEEvaluator(e.net)
+}
@@ -0,0 +1,177 @@
+package chester_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/bluescreen10/chester"
+)
+
+// tinyNetwork is a HalfKA network with 2 king buckets, 8 accumulator
+// values and 2 dense layers with random weights.
+const tinyNetwork = "testdata/tiny.nnue"
+
+func TestNetwork_Evaluate(t *testing.T) {
+	net, err := chester.LoadNetwork(tinyNetwork)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// scores computed with an independent implementation of the format
+	tests := []struct {
+		fen   string
+		score int
+	}{
+		{chester.DefaultFEN, -125},
+		{"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", -5},
+		{"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R b KQkq - 0 1", -174},
+		{"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1", -14},
+		{"8/8/8/4k3/8/8/1P6/4K3 b - - 0 1", -46},
+	}
+
+	for _, test := range tests {
+		p, err := chester.ParseFEN(test.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := net.Evaluate(p); got != test.score {
+			t.Errorf("%s: got %d, want %d", test.fen, got, test.score)
+		}
+	}
+}
+
+func TestNNUEEvaluator(t *testing.T) {
+	net, err := chester.LoadNetwork(tinyNetwork)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := rand.New(rand.NewSource(1))
+	e := chester.NewNNUEEvaluator(net)
+
+	for _, fen := range []string{chester.DefaultFEN, "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1"} {
+		for range 20 {
+			root, _ := chester.ParseFEN(fen)
+			e.Reset(root)
+			root.SetObserver(e)
+
+			// walk down a random line, going back a ply now and then
+			line := []*chester.Position{root}
+			for range 100 {
+				p := line[len(line)-1]
+				moves, _ := chester.LegalMoves(nil, p)
+				if len(moves) == 0 {
+					break
+				}
+
+				e.Push()
+				child := *p
+				child.Do(moves[r.Intn(len(moves))])
+				line = append(line, &child)
+
+				if got, want := e.Evaluate(&child), net.Evaluate(&child); got != want {
+					t.Fatalf("%s: got %d incrementally, want %d", child.FEN(), got, want)
+				}
+
+				if r.Intn(4) == 0 {
+					e.Pop()
+					line = line[:len(line)-1]
+					p := line[len(line)-1]
+					if got, want := e.Evaluate(p), net.Evaluate(p); got != want {
+						t.Fatalf("%s: got %d after pop, want %d", p.FEN(), got, want)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestNetwork_WriteTo(t *testing.T) {
+	data, err := os.ReadFile(tinyNetwork)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	net, err := chester.ReadNetwork(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	n, err := net.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(data)) || !bytes.Equal(buf.Bytes(), data) {
+		t.Errorf("got %d bytes written, want the %d bytes read", n, len(data))
+	}
+
+	// the sizes must match
+	net.Layers[0].Weights = net.Layers[0].Weights[1:]
+	if _, err := net.WriteTo(&buf); !errors.Is(err, chester.ErrInvalidNetwork) {
+		t.Errorf("got error %v writing a broken network, want %v", err, chester.ErrInvalidNetwork)
+	}
+}
+
+func TestReadNetwork_Invalid(t *testing.T) {
+	data, err := os.ReadFile(tinyNetwork)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	badMagic := bytes.Clone(data)
+	badMagic[0] = 'X'
+	if _, err := chester.ReadNetwork(bytes.NewReader(badMagic)); !errors.Is(err, chester.ErrInvalidNetwork) {
+		t.Errorf("bad magic: got error %v, want %v", err, chester.ErrInvalidNetwork)
+	}
+
+	if _, err := chester.ReadNetwork(bytes.NewReader(data[:len(data)-1])); err == nil {
+		t.Errorf("truncated: got no error")
+	}
+
+	// the header is followed by the king buckets at byte 12 and the
+	// accumulator size at byte 76
+	tests := map[string]func(header []byte){
+		"bucket": func(header []byte) {
+			header[12+63] = 255
+		},
+		"weights": func(header []byte) {
+			for i := range 64 {
+				header[12+i] = byte(i)
+			}
+			binary.LittleEndian.PutUint32(header[76:], 4096)
+		},
+	}
+	for name, corrupt := range tests {
+		header := bytes.Clone(data)
+		corrupt(header)
+		if _, err := chester.ReadNetwork(bytes.NewReader(header)); !errors.Is(err, chester.ErrInvalidNetwork) {
+			t.Errorf("%s: got error %v, want %v", name, err, chester.ErrInvalidNetwork)
+		}
+	}
+}
+
+func TestSearch_NNUE(t *testing.T) {
+	net, err := chester.LoadNetwork(tinyNetwork)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, _ := chester.ParseFEN("r2q1rk1/ppp2ppp/2np1n2/2b1p1B1/2B1P1b1/2NP1N2/PPP2PPP/R2Q1RK1 w - - 0 8")
+	best, err := chester.Search(context.Background(), p, chester.SearchOptions{
+		MaxDepth:  2,
+		Evaluator: chester.NewNNUEEvaluator(net),
+		Threads:   2,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if best.Best == 0 {
+		t.Errorf("got no move")
+	}
+}
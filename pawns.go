@@ -0,0 +1,197 @@
+package chester
+
+import (
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// defaultPawnTableSize is the size in bytes of the pawn table used by
+// [EvalClassical].
+const defaultPawnTableSize = 1024 * 1024
+
+// pawnTermCount is the number of pawn structure terms, from
+// termPassedPawns to termBackwardPawns, cached in a [PawnEntry].
+const pawnTermCount = termBackwardPawns - termPassedPawns + 1
+
+// PawnEntry holds the evaluation data that only depends on the pawns of a
+// position. See [PawnTable].
+type PawnEntry struct {
+	key uint64
+
+	// terms holds the pawn structure terms of the classical evaluation
+	// per color, indexed from termPassedPawns.
+	terms [pawnTermCount][Color(2)]evalScore
+
+	// Passed holds the passed pawns of each color.
+	Passed [Color(2)]Bitboard
+
+	// Attacks holds the squares attacked by the pawns of each color.
+	Attacks [Color(2)]Bitboard
+
+	// shelter counts the pawns of the shield in front of a king on its
+	// first (0) or second (1) relative rank, per file.
+	shelter [Color(2)][2][8]uint8
+}
+
+// Score returns the midgame and endgame pawn structure score of color:
+// passed, isolated, doubled and backward pawns as scored by
+// [EvalClassical].
+func (e *PawnEntry) Score(color Color) (mg, eg int) {
+	for term := range pawnTermCount {
+		mg += e.terms[term][color].mg
+		eg += e.terms[term][color].eg
+	}
+	return mg, eg
+}
+
+// Shelter returns the number of pawns of color shielding a king of color
+// on kingSq, on the king file and the adjacent ones, up to two ranks ahead
+// of it. A king that left its first two ranks has no shelter.
+func (e *PawnEntry) Shelter(color Color, kingSq Square) int {
+	rank := relativeRank(color, kingSq)
+	if rank > 1 {
+		return 0
+	}
+	return int(e.shelter[color][rank][kingSq.File()])
+}
+
+// PawnTable caches the pawn structure evaluation of positions by their
+// [Position.PawnHash]. Pawn structures change rarely during a search, so
+// most probes are hits and the pawn terms don't need to be recomputed.
+//
+// Entries are immutable once stored and the slots are read and written
+// atomically, so a PawnTable can be shared by several search threads
+// without locking. Custom [EvalFunc]s can keep their own table and use the
+// entries it returns.
+type PawnTable struct {
+	slots []atomic.Pointer[PawnEntry]
+	mask  uint64
+}
+
+// NewPawnTable creates a pawn table with the given maximum size in bytes.
+// The number of entries is rounded down to a power of two.
+func NewPawnTable(maxSize uint64) *PawnTable {
+	count := maxSize / uint64(unsafe.Sizeof(atomic.Pointer[PawnEntry]{})+unsafe.Sizeof(PawnEntry{}))
+
+	size := uint64(1)
+	for size*2 <= count {
+		size *= 2
+	}
+
+	return &PawnTable{slots: make([]atomic.Pointer[PawnEntry], size), mask: size - 1}
+}
+
+// Probe returns the entry for the pawns of p, computing and storing it if
+// it isn't in the table. The entry is shared and must not be modified.
+func (t *PawnTable) Probe(p *Position) *PawnEntry {
+	key := p.pawnHash
+	slot := &t.slots[key&t.mask]
+
+	if entry := slot.Load(); entry != nil && entry.key == key {
+		return entry
+	}
+
+	entry := newPawnEntry(p)
+	slot.Store(entry)
+	return entry
+}
+
+// Clear removes all the entries from the table. It must not be called while
+// a search is using the table.
+func (t *PawnTable) Clear() {
+	for i := range t.slots {
+		t.slots[i].Store(nil)
+	}
+}
+
+// classicalPawnTable is the pawn table shared by every classical
+// evaluation, allocated on first use.
+var classicalPawnTable = sync.OnceValue(func() *PawnTable {
+	return NewPawnTable(defaultPawnTableSize)
+})
+
+// newPawnEntry computes the pawn entry of p.
+func newPawnEntry(p *Position) *PawnEntry {
+	entry := &PawnEntry{key: p.pawnHash}
+
+	for color := range Color(2) {
+		entry.Attacks[color] = pawnAttacks(color, p.pieces[Pawn]&p.allPieces[color])
+	}
+
+	for color := range Color(2) {
+		entry.evaluate(p, color)
+		entry.initShelter(p, color)
+	}
+
+	return entry
+}
+
+// add adds s to the pawn term of color.
+func (e *PawnEntry) add(term evalTerm, color Color, s evalScore) {
+	e.terms[term-termPassedPawns][color].mg += s.mg
+	e.terms[term-termPassedPawns][color].eg += s.eg
+}
+
+// evaluate scores the pawn structure of color.
+func (e *PawnEntry) evaluate(p *Position, color Color) {
+	own := p.pieces[Pawn] & p.allPieces[color]
+	enemy := p.pieces[Pawn] & p.allPieces[color^1]
+	enemyAttacks := e.Attacks[color^1]
+
+	bb := own
+	for bb != 0 {
+		var sq Square
+		sq, bb = bb.PopLSB()
+		rank, file := sq.RankAndFile()
+
+		if forwardFileMask[color][sq]&own != 0 {
+			e.add(termDoubledPawns, color, doubledPawnPenalty)
+		} else if passedPawnMask[color][sq]&enemy == 0 {
+			e.add(termPassedPawns, color, passedPawnBonus[relativeRank(color, sq)])
+			e.Passed[color] |= NewBitboardFromSquare(sq)
+		}
+
+		if adjacentFilesMask[file]&own == 0 {
+			e.add(termIsolatedPawns, color, isolatedPawnPenalty)
+			continue
+		}
+
+		// backward: all the neighbours are ahead and the square in front
+		// is controlled by an enemy pawn
+		stop := sq - 8
+		if color == Black {
+			stop = sq + 8
+		}
+		behind := adjacentFilesMask[file] &^ forwardRanksMask[color][rank]
+		if behind&own == 0 && NewBitboardFromSquare(stop)&enemyAttacks != 0 {
+			e.add(termBackwardPawns, color, backwardPawnPenalty)
+		}
+	}
+}
+
+// initShelter counts the shield pawns of color for a king on each file of
+// its first two ranks.
+func (e *PawnEntry) initShelter(p *Position, color Color) {
+	own := p.pieces[Pawn] & p.allPieces[color]
+
+	for relative := range 2 {
+		rank := relative
+		if color == Black {
+			rank = 7 - relative
+		}
+
+		// the two ranks in front of the king
+		ahead := forwardRanksMask[color][rank]
+		if color == White {
+			ahead &^= forwardRanksMask[color][min(rank+2, 7)]
+		} else {
+			ahead &^= forwardRanksMask[color][max(rank-2, 0)]
+		}
+
+		for file := range 8 {
+			shield := ahead & (fileMask[file] | adjacentFilesMask[file]) & own
+			e.shelter[color][relative][file] = uint8(shield.OnesCount())
+		}
+	}
+}
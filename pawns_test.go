@@ -0,0 +1,142 @@
+package chester_test
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/bluescreen10/chester"
+)
+
+func TestPawnHash(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	for range 50 {
+		p, _ := chester.ParseFEN(chester.DefaultFEN)
+
+		for range 200 {
+			var moves []chester.Move
+			moves, _ = chester.LegalMoves(moves, p)
+			if len(moves) == 0 {
+				break
+			}
+
+			before := *p
+			m := moves[r.Intn(len(moves))]
+			p.Do(m)
+
+			want, err := chester.ParseFEN(p.FEN())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := p.PawnHash(); got != want.PawnHash() {
+				t.Fatalf("%s: Do(%s) got pawn hash %x, want %x", before.FEN(), m, got, want.PawnHash())
+			}
+
+			pawnsMoved := before.WhitePawns() != p.WhitePawns() || before.BlackPawns() != p.BlackPawns()
+			if pawnsMoved != (before.PawnHash() != p.PawnHash()) {
+				t.Fatalf("%s: Do(%s) pawns changed %v, pawn hash changed %v", before.FEN(), m, pawnsMoved, !pawnsMoved)
+			}
+		}
+	}
+}
+
+func TestPawnTable(t *testing.T) {
+	tests := []struct {
+		fen     string
+		passed  [2]chester.Bitboard
+		shelter [2]int
+	}{
+		{
+			fen:     chester.DefaultFEN,
+			shelter: [2]int{3, 3},
+		},
+		{
+			fen:     "4k3/8/8/8/3P4/8/8/4K3 w - - 0 1",
+			passed:  [2]chester.Bitboard{chester.NewBitboardFromSquare(chester.SQ_D4), 0},
+			shelter: [2]int{0, 0},
+		},
+		{
+			fen:     "6k1/p4ppp/8/8/8/8/5PPP/6K1 w - - 0 1",
+			passed:  [2]chester.Bitboard{0, chester.NewBitboardFromSquare(chester.SQ_A7)},
+			shelter: [2]int{3, 3},
+		},
+		{
+			fen:     "8/8/8/3k4/8/8/5PPP/3K4 w - - 0 1",
+			passed:  [2]chester.Bitboard{chester.NewBitboardFromSquare(chester.SQ_F2) | chester.NewBitboardFromSquare(chester.SQ_G2) | chester.NewBitboardFromSquare(chester.SQ_H2), 0},
+			shelter: [2]int{0, 0},
+		},
+	}
+
+	table := chester.NewPawnTable(1024 * 1024)
+
+	for _, test := range tests {
+		p, err := chester.ParseFEN(test.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		entry := table.Probe(p)
+		for color := range chester.Color(2) {
+			if entry.Passed[color] != test.passed[color] {
+				t.Errorf("%s: got passed pawns %x for color %d, want %x", test.fen, entry.Passed[color], color, test.passed[color])
+			}
+
+			king := p.WhiteKing()
+			if color == chester.Black {
+				king = p.BlackKing()
+			}
+			sq, _ := king.PopLSB()
+			if got := entry.Shelter(color, sq); got != test.shelter[color] {
+				t.Errorf("%s: got shelter %d for color %d, want %d", test.fen, got, color, test.shelter[color])
+			}
+		}
+
+		if again := table.Probe(p); again != entry {
+			t.Errorf("%s: got a different entry on the second probe", test.fen)
+		}
+	}
+}
+
+func TestPawnTable_Score(t *testing.T) {
+	p, _ := chester.ParseFEN("4k3/8/8/8/3P4/8/8/4K3 w - - 0 1")
+	entry := chester.NewPawnTable(1024).Probe(p)
+
+	if mg, eg := entry.Score(chester.White); mg <= 0 || eg <= 0 {
+		t.Errorf("got white pawn score %d %d, want the passed pawn bonus to outweigh the isolated penalty", mg, eg)
+	}
+
+	if mg, eg := entry.Score(chester.Black); mg != 0 || eg != 0 {
+		t.Errorf("got black pawn score %d %d, want 0", mg, eg)
+	}
+}
+
+func TestPawnTable_Concurrent(t *testing.T) {
+	fens := []string{
+		chester.DefaultFEN,
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+		"4k3/pppppppp/8/8/8/8/PPPPPPPP/1N2K3 w - - 0 1",
+	}
+
+	// a tiny table so the threads keep replacing each other's entries
+	table := chester.NewPawnTable(1)
+
+	var wg sync.WaitGroup
+	for i := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 1000 {
+				fen := fens[(i+j)%len(fens)]
+				p, _ := chester.ParseFEN(fen)
+				want := chester.NewPawnTable(1024).Probe(p)
+				if got := table.Probe(p); *got != *want {
+					t.Errorf("%s: got a different entry from the shared table", fen)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
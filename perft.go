@@ -26,7 +26,7 @@ func Perft(p *Position, depth int) <-chan MoveCount {
 			if depth == 1 {
 				ch <- MoveCount{Move: m, Count: 1}
 			} else {
-				newPos = *p
+				newPos = p.Copy()
 				newPos.Do(m)
 				newNodes := perft(&newPos, moves[count:], depth-1)
 				ch <- MoveCount{Move: m, Count: newNodes}
@@ -52,7 +52,7 @@ func perft(p *Position, moves []Move, depth int) int {
 	var newPos Position
 	m := moves[len(moves):]
 	for i := 0; i < len(moves); i++ {
-		newPos = *p
+		newPos = p.Copy()
 		newPos.Do(moves[i])
 		nodes += perft(&newPos, m, depth-1)
 	}
@@ -53,6 +53,13 @@ type Position struct {
 	// Zobrist hash maintained incrementally by Do, move, put, and remove.
 	hash uint64
 
+	// Zobrist hash of the pawns alone, maintained alongside hash.
+	pawnHash uint64
+
+	// Zobrist hash of the number of pieces of each type and color,
+	// maintained by put and remove.
+	materialHash uint64
+
 	// Maps each square index to the piece occupying it, or Empty.
 	mailbox [64]Piece
 
@@ -71,6 +78,9 @@ type Position struct {
 
 	// Full-move counter; starts at 1 and increments after Black's move.
 	fullMoves uint16
+
+	// Optional observer notified by move, put, and remove.
+	observer PieceObserver
 }
 
 // ParseFEN parses a FEN string and returns the resulting Position.
@@ -196,6 +206,8 @@ func ParseFEN(fen string) (*Position, error) {
 	pos.fullMoves = uint16(fullMoves)
 
 	pos.hash = computeHash(&pos)
+	pos.pawnHash = computePawnHash(&pos)
+	pos.materialHash = computeMaterialHash(&pos)
 	return &pos, nil
 }
 
@@ -369,6 +381,27 @@ func (p *Position) Occupied() Bitboard {
 	return p.allPieces[White] | p.allPieces[Black]
 }
 
+// SetObserver attaches o to the position so it is notified of every piece
+// placed, removed or moved from now on. A nil o detaches the current
+// observer. Copies of the position made by assignment keep notifying o,
+// use [Position.Copy] to play moves on a copy without notifying it.
+func (p *Position) SetObserver(o PieceObserver) {
+	p.observer = o
+}
+
+// Copy returns a copy of the position with no observer attached.
+func (p *Position) Copy() Position {
+	pos := *p
+	pos.observer = nil
+	return pos
+}
+
+// InCheck reports whether the king of the active color is attacked.
+func (p *Position) InCheck() bool {
+	kingSq, _ := p.King().PopLSB()
+	return attackersTo(p, kingSq, p.Occupied())&p.Enemies() != 0
+}
+
 // Do applies a move to the position, updating piece placement, the mailbox,
 // castling rights, en passant state, half-move clock, full-move counter,
 // active/inactive colors, and the Zobrist hash. The move must be legal;
@@ -638,6 +671,20 @@ func (p *Position) Hash() uint64 {
 	return p.hash
 }
 
+// PawnHash returns the Zobrist hash of the pawns of the position, which
+// only changes when a pawn moves, is captured or promotes. It is the key
+// of a [PawnTable].
+func (p *Position) PawnHash() uint64 {
+	return p.pawnHash
+}
+
+// MaterialHash returns the Zobrist hash of the material of the position,
+// the number of pieces of each type and color regardless of where they
+// stand. It is the key of a [MaterialTable].
+func (p *Position) MaterialHash() uint64 {
+	return p.materialHash
+}
+
 // WhitePieces returns a Bitboard with a bit set for every square occupied
 // by a white piece.
 func (p *Position) WhitePieces() Bitboard {
@@ -676,7 +723,7 @@ func (p *Position) updateCastlingRights(sq Square) {
 }
 
 // move relocates a piece of color from its current square to a new square.
-// It incrementally updates the internal mailbox, bitboards, and Zobrist hash.
+// It incrementally updates the internal mailbox, bitboards, and Zobrist hashes.
 func (p *Position) move(piece Piece, color Color, from, to Square) {
 	p.mailbox[from] = Empty
 	p.mailbox[to] = piece
@@ -685,10 +732,18 @@ func (p *Position) move(piece Piece, color Color, from, to Square) {
 	p.pieces[piece] ^= fromAndTo
 	p.hash ^= polyglotTable.Pieces[color][piece][from]
 	p.hash ^= polyglotTable.Pieces[color][piece][to]
+	if piece == Pawn {
+		p.pawnHash ^= polyglotTable.Pieces[color][Pawn][from]
+		p.pawnHash ^= polyglotTable.Pieces[color][Pawn][to]
+	}
+
+	if p.observer != nil {
+		p.observer.PieceMoved(piece, color, from, to)
+	}
 }
 
 // put places a specific piece of color on sq. It incrementally updates the
-// mailbox, bitboards, and Zobrist hash.
+// mailbox, bitboards, and Zobrist hashes.
 func (p *Position) put(piece Piece, color Color, sq Square) {
 	p.mailbox[sq] = piece
 
@@ -696,10 +751,19 @@ func (p *Position) put(piece Piece, color Color, sq Square) {
 	p.allPieces[color] |= bb
 	p.pieces[piece] |= bb
 	p.hash ^= polyglotTable.Pieces[color][piece][sq]
+	if piece == Pawn {
+		p.pawnHash ^= polyglotTable.Pieces[color][Pawn][sq]
+	}
+	count := (p.pieces[piece] & p.allPieces[color]).OnesCount()
+	p.materialHash ^= polyglotTable.Pieces[color][piece][count-1]
+
+	if p.observer != nil {
+		p.observer.PieceAdded(piece, color, sq)
+	}
 }
 
 // remove clears any piece of color from sq. It incrementally updates the
-// mailbox, bitboards, and Zobrist hash.
+// mailbox, bitboards, and Zobrist hashes.
 func (p *Position) remove(piece Piece, color Color, sq Square) {
 	p.mailbox[sq] = Empty
 
@@ -707,6 +771,15 @@ func (p *Position) remove(piece Piece, color Color, sq Square) {
 	p.allPieces[color] &^= bb
 	p.pieces[piece] &^= bb
 	p.hash ^= polyglotTable.Pieces[color][piece][sq]
+	if piece == Pawn {
+		p.pawnHash ^= polyglotTable.Pieces[color][Pawn][sq]
+	}
+	count := (p.pieces[piece] & p.allPieces[color]).OnesCount()
+	p.materialHash ^= polyglotTable.Pieces[color][piece][count]
+
+	if p.observer != nil {
+		p.observer.PieceRemoved(piece, color, sq)
+	}
 }
 
 // computeHash calculates the Polyglot-compatible Zobrist hash for the entire
@@ -738,3 +811,38 @@ func computeHash(p *Position) uint64 {
 
 	return hash
 }
+
+// computePawnHash calculates the Zobrist hash of the pawns of the position
+// from scratch.
+func computePawnHash(p *Position) uint64 {
+	var hash uint64
+
+	for color := range Color(2) {
+		bb := p.pieces[Pawn] & p.allPieces[color]
+		var sq Square
+		for bb != 0 {
+			sq, bb = bb.PopLSB()
+			hash ^= polyglotTable.Pieces[color][Pawn][sq]
+		}
+	}
+
+	return hash
+}
+
+// computeMaterialHash calculates the material hash of the position from
+// scratch. The key of the n-th piece of a type and color is the one of
+// that piece on the n-th square.
+func computeMaterialHash(p *Position) uint64 {
+	var hash uint64
+
+	for color := range Color(2) {
+		for piece := Pawn; piece <= King; piece++ {
+			count := (p.pieces[piece] & p.allPieces[color]).OnesCount()
+			for n := range count {
+				hash ^= polyglotTable.Pieces[color][piece][n]
+			}
+		}
+	}
+
+	return hash
+}
@@ -293,3 +293,68 @@ func TestPositionString(t *testing.T) {
 		t.Errorf("Position.String() failed\ngot:\n%s\nwant:\n%s", got, expected)
 	}
 }
+
+func TestInCheck(t *testing.T) {
+	tests := []struct {
+		fen      string
+		expected bool
+	}{
+		{fen: chester.DefaultFEN, expected: false},
+		{fen: "4k3/8/8/8/8/8/3p4/4K3 w - - 0 1", expected: true},
+		{fen: "4k3/8/8/8/8/8/4p3/4K3 w - - 0 1", expected: false},
+		{fen: "4k3/8/8/b7/8/8/3P4/4K3 w - - 0 1", expected: false},
+		{fen: "4k3/8/8/b7/8/8/8/4K3 w - - 0 1", expected: true},
+		{fen: "4k3/8/5N2/8/8/8/8/4K3 b - - 0 1", expected: true},
+		{fen: "4k3/8/8/8/8/8/8/R3K3 b - - 0 1", expected: false},
+		{fen: "4k3/8/8/8/8/8/8/4K2R b - - 0 1", expected: false},
+		{fen: "4k3/8/8/8/8/8/8/4R1K1 b - - 0 1", expected: true},
+	}
+
+	for _, test := range tests {
+		p, err := chester.ParseFEN(test.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := p.InCheck(); got != test.expected {
+			t.Errorf("InCheck(%s) got %t, want %t", test.fen, got, test.expected)
+		}
+	}
+}
+
+// countingObserver counts the pieces placed, removed and moved.
+type countingObserver int
+
+func (o *countingObserver) PieceAdded(chester.Piece, chester.Color, chester.Square)   { *o++ }
+func (o *countingObserver) PieceRemoved(chester.Piece, chester.Color, chester.Square) { *o++ }
+func (o *countingObserver) PieceMoved(chester.Piece, chester.Color, chester.Square, chester.Square) {
+	*o++
+}
+
+func TestPositionCopy(t *testing.T) {
+	p, _ := chester.ParseFEN(chester.DefaultFEN)
+	var observer countingObserver
+	p.SetObserver(&observer)
+
+	child := p.Copy()
+	child.Do(chester.NewMove(chester.SQ_E2, chester.SQ_E4))
+	if observer != 0 {
+		t.Errorf("got %d notifications from the copy, want none", observer)
+	}
+	if p.FEN() != chester.DefaultFEN {
+		t.Error("playing a move on the copy changed the position")
+	}
+
+	p.Do(chester.NewMove(chester.SQ_E2, chester.SQ_E4))
+	if observer == 0 {
+		t.Error("copying detached the observer of the position")
+	}
+
+	// nor do the move counts from it
+	observer = 0
+	for range chester.Perft(p, 2) {
+	}
+	if observer != 0 {
+		t.Errorf("got %d notifications from perft, want none", observer)
+	}
+}
@@ -0,0 +1,75 @@
+package chester
+
+// Score is a search score from the side to move perspective. Regular scores
+// are measured in centipawns while scores beyond the mate threshold encode
+// the distance to a forced checkmate.
+type Score int
+
+// MateScore is the base score for a checkmate. The actual score is
+// adjusted by ply to favor shorter mates: a side that mates in n plies
+// scores MateScore - n and the side being mated scores -(MateScore - n).
+const MateScore Score = 31_000
+
+// mateThreshold is the lowest absolute value of a mate score. Mates are
+// found up to maxPly plies from the root, and tablebase mates are probed
+// there up to maxTablebaseDTM plies further.
+const mateThreshold = int(MateScore) - maxPly - maxTablebaseDTM
+
+// IsMate reports whether the score represents a forced checkmate for either
+// side.
+func (s Score) IsMate() bool {
+	return int(s) >= mateThreshold || int(s) <= -mateThreshold
+}
+
+// MateIn returns the number of moves (not plies) to checkmate. It is
+// positive when the side to move delivers mate and negative when it is
+// being mated. It returns zero if the score is not a mate score.
+func (s Score) MateIn() int {
+	switch {
+	case int(s) >= mateThreshold:
+		return (int(MateScore-s) + 1) / 2
+	case int(s) <= -mateThreshold:
+		return -(int(MateScore+s) + 1) / 2
+	default:
+		return 0
+	}
+}
+
+// Centipawns returns the score in centipawns. For mate scores the returned
+// value is only meaningful for comparison purposes.
+func (s Score) Centipawns() int {
+	return int(s)
+}
+
+// matedIn returns the score of the side to move being checkmated at ply.
+func matedIn(ply int) int {
+	return -int(MateScore) + ply
+}
+
+// scoreToTT converts a score relative to the root into a score relative to
+// the position at ply before storing it in the transposition table. Mate
+// scores are made independent of the path to the position so they remain
+// correct when the position is reached through a transposition.
+func scoreToTT(score, ply int) int {
+	switch {
+	case score >= mateThreshold:
+		return score + ply
+	case score <= -mateThreshold:
+		return score - ply
+	default:
+		return score
+	}
+}
+
+// scoreFromTT is the inverse of scoreToTT, it converts a score retrieved
+// from the transposition table at ply back to a score relative to the root.
+func scoreFromTT(score, ply int) int {
+	switch {
+	case score >= mateThreshold:
+		return score - ply
+	case score <= -mateThreshold:
+		return score + ply
+	default:
+		return score
+	}
+}
@@ -0,0 +1,41 @@
+package chester_test
+
+import (
+	"testing"
+
+	"github.com/bluescreen10/chester"
+)
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		score      chester.Score
+		isMate     bool
+		mateIn     int
+		centipawns int
+	}{
+		{score: 0, isMate: false, mateIn: 0, centipawns: 0},
+		{score: 150, isMate: false, mateIn: 0, centipawns: 150},
+		{score: -320, isMate: false, mateIn: 0, centipawns: -320},
+		{score: chester.MateScore - 1, isMate: true, mateIn: 1, centipawns: int(chester.MateScore - 1)},
+		{score: chester.MateScore - 3, isMate: true, mateIn: 2, centipawns: int(chester.MateScore - 3)},
+		{score: -chester.MateScore + 2, isMate: true, mateIn: -1, centipawns: int(-chester.MateScore + 2)},
+		{score: -chester.MateScore + 4, isMate: true, mateIn: -2, centipawns: int(-chester.MateScore + 4)},
+		{score: chester.MateScore - 381, isMate: true, mateIn: 191, centipawns: int(chester.MateScore - 381)},
+		{score: -chester.MateScore + 382, isMate: true, mateIn: -191, centipawns: int(-chester.MateScore + 382)},
+		{score: 10_000, isMate: false, mateIn: 0, centipawns: 10_000},
+	}
+
+	for _, test := range tests {
+		if got := test.score.IsMate(); got != test.isMate {
+			t.Errorf("Score(%d).IsMate() got %t, want %t", test.score, got, test.isMate)
+		}
+
+		if got := test.score.MateIn(); got != test.mateIn {
+			t.Errorf("Score(%d).MateIn() got %d, want %d", test.score, got, test.mateIn)
+		}
+
+		if got := test.score.Centipawns(); got != test.centipawns {
+			t.Errorf("Score(%d).Centipawns() got %d, want %d", test.score, got, test.centipawns)
+		}
+	}
+}
@@ -5,15 +5,25 @@ import (
 	"errors"
 	"math"
 	"math/rand/v2"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const (
 	// Inf is a value representing positive infinity for search scores.
-	Inf = 1_000_000_000
-	// MateScore is the base score for a checkmate. The actual score is
-	// adjusted by ply to favor shorter mates.
-	MateScore = 1_000_000
+	// All scores fit in 16 bits so they can be packed in the
+	// transposition table.
+	Inf = 32_000
+
+	// maxPly is the deepest ply the search will ever reach. Positions at
+	// this ply are statically evaluated.
+	maxPly = 128
+
+	// deltaMargin is the safety margin, in centipawns, used by delta
+	// pruning in the quiescence search.
+	deltaMargin = 200
 )
 
 // Evaluation holds the result of a search at a given depth.
@@ -24,8 +34,41 @@ type Evaluation struct {
 	// Best move in pure algebraic coordinate notation (e.g. "e2e4").
 	Best Move
 
-	// Centipawn score from the side to move perspective
-	Score int
+	// Score from the side to move perspective
+	Score Score
+
+	// PV is the principal variation, the sequence of moves the engine
+	// expects to be played, starting with Best.
+	PV []Move
+
+	// MultiPV is the rank of this line among the lines searched at Depth,
+	// starting from 1 for the best one. See [SearchOptions.MultiPV].
+	MultiPV int
+
+	// SelDepth is the deepest ply reached, including the quiescence
+	// search, during the iteration.
+	SelDepth int
+
+	// Nodes is the number of positions visited by all the threads since
+	// the beginning of the search.
+	Nodes int64
+
+	// QNodes is the number of those positions visited by the quiescence
+	// search.
+	QNodes int64
+
+	// Time is the time elapsed since the beginning of the search.
+	Time time.Duration
+
+	// NPS is the number of nodes visited per second.
+	NPS int64
+
+	// Hashfull is the transposition table usage in permille.
+	Hashfull int
+
+	// TTHitRate is the fraction of transposition table probes that found
+	// the probed position, between 0 and 1.
+	TTHitRate float64
 }
 
 // EvalFunc defines the signature for a function that performs a static
@@ -42,14 +85,23 @@ type EvalFunc func(*Position) int
 type SearchOptions struct {
 	// MaxTime is the maximum duration the search is allowed to run.
 	// If the timer expires, the search returns the best move found
-	// from the last fully completed depth.
+	// from the last fully completed depth, or a better root move fully
+	// searched in the aborted one.
 	MaxTime time.Duration
 
+	// SoftTime is the time after which the search doesn't start a new
+	// iteration. It is extended when the best move or the score are
+	// unstable, and cut when there is a single legal move or an obvious
+	// recapture, but the search never runs past MaxTime. Zero disables
+	// it. See [TimeControl.Limits].
+	SoftTime time.Duration
+
 	// MaxNodes is the maximum number of positions (nodes) the engine
-	// will visit before aborting the search.
+	// will visit before aborting the search. Zero means no limit.
 	MaxNodes int64
 
 	// MaxDepth is the maximum number of plies (half-moves) to search.
+	// Zero means no limit.
 	MaxDepth int
 
 	// Moves is an optional list of specific moves to search. If empty,
@@ -60,10 +112,69 @@ type SearchOptions struct {
 	// in the search tree.
 	EvalFunc EvalFunc
 
+	// Evaluator is used to score leaf nodes instead of EvalFunc when not
+	// nil. An [IncrementalEvaluator] is cloned for every search thread and
+	// kept up to date as moves are played. When neither is set the
+	// incremental version of [EvalPesto] is used.
+	Evaluator Evaluator
+
+	// EvalParams, if not nil, replaces the parameters of the PeSTO
+	// evaluation used when neither EvalFunc nor Evaluator are set.
+	EvalParams *EvalParams
+
 	// Optionally you can pass a transposition table to be used
 	TranspositionTable *TranspositionTable
+
+	// Tablebase, if not nil, is probed at the root, where the move
+	// keeping the best result is played without searching, and at the
+	// interior nodes, which are scored exactly.
+	Tablebase *Tablebase
+
+	// QuiescenceChecks enables the generation of quiet checking moves
+	// at the first ply of the quiescence search.
+	QuiescenceChecks bool
+
+	// History is the list of Zobrist hashes of the positions played in
+	// the game before the position being searched, oldest first. It is
+	// used to detect draws by repetition.
+	History []uint64
+
+	// Contempt is the score, in centipawns, the side to move at the root
+	// gives up when agreeing to a draw. Positive values make the engine
+	// avoid draws, negative values make it seek them.
+	Contempt int
+
+	// PonderHit enables pondering. When not nil, the search runs without
+	// time limit until the channel is closed (or receives a value), then
+	// MaxTime starts counting. The search never finishes before the
+	// ponder hit unless it is cancelled.
+	PonderHit <-chan struct{}
+
+	// OnCurrMove, if not nil, is called with the root move about to be
+	// searched at depth and its position in the root move list, starting
+	// from 1. Updates only start once the search has run for a second.
+	OnCurrMove func(depth int, m Move, number int)
+
+	// MultiPV is the number of best lines to search. At every depth one
+	// [Evaluation] is reported per line, ordered by score. Zero means a
+	// single line.
+	MultiPV int
+
+	// Threads is the number of goroutines searching in parallel. Helper
+	// threads share the transposition table with the main thread (Lazy
+	// SMP) so a table should be provided when using more than one thread.
+	// Zero means a single thread.
+	Threads int
 }
 
+// ErrNoMoves is returned by [Search] when there are no legal moves to
+// search in the position.
+var ErrNoMoves = errors.New("no legal moves")
+
+// ErrNodeLimit is returned by [Search] when [SearchOptions.MaxNodes] runs
+// out before any move was searched.
+var ErrNodeLimit = errors.New("node limit reached before any move was searched")
+
 var (
 	// errMaxNodesReached is returned when the search is aborted because the
 	// total number of visited nodes exceeds [SearchOptions.MaxNodes].
@@ -93,6 +204,17 @@ type searchCtx struct {
 	// tranposition table
 	tt *TranspositionTable
 
+	// eval is the static evaluation used at the leaves. When it is
+	// incremental, incremental holds the same evaluator.
+	eval        Evaluator
+	incremental IncrementalEvaluator
+
+	// qchecks enables quiet checks at the first quiescence ply.
+	qchecks bool
+
+	// tb is the endgame tablebase, nil when not probed.
+	tb *Tablebase
+
 	// maxNodes is the hard limit for total nodes allowed for this search.
 	maxNodes int64
 
@@ -100,13 +222,258 @@ type searchCtx struct {
 	// the main negamax search.
 	nodes int64
 
-	// qnodes tracks the number of positions visited specifically
-	// during the quiescence search.
-	qnodes int64
+	// qnodes, ttProbes and ttHits track the number of positions visited
+	// during the quiescence search and the transposition table probes
+	// and hits since they were last flushed into shared.
+	qnodes   int64
+	ttProbes int64
+	ttHits   int64
+
+	// selDepth is the deepest ply reached in the current iteration.
+	selDepth int
+
+	// onCurrMove is called before searching every root move.
+	onCurrMove func(depth int, m Move, number int)
+
+	// tm decides when the main thread stops iterating.
+	tm *timeManager
+
+	// shared holds the state shared by all the threads of a search.
+	shared *sharedSearch
+
+	// id identifies the thread, the main thread is always zero.
+	id int
+
+	// history holds the hashes of the game positions followed by the
+	// hashes of the positions in the current search path. The root
+	// position is at index root.
+	history []uint64
+	root    int
+
+	// contempt is the draw score penalty for the side to move at the root.
+	contempt int
+
+	// pv and pvLen form a triangular table holding the principal
+	// variation found at each ply.
+	pv    [maxPly + 1][maxPly + 1]Move
+	pvLen [maxPly + 1]int
+
+	// depth, bestMove, bestScore and bestPV hold the result of the last
+	// iteration completed by this thread.
+	depth     int
+	bestMove  Move
+	bestScore int
+	bestPV    []Move
+}
+
+// sharedSearch holds the state shared by every thread taking part in a
+// search.
+type sharedSearch struct {
+	// nodes is the number of nodes visited by all threads. Threads flush
+	// their local counters into it every nodesBatch nodes.
+	nodes atomic.Int64
+
+	// qnodes, ttProbes and ttHits aggregate the statistics of all the
+	// threads, flushed alongside nodes.
+	qnodes   atomic.Int64
+	ttProbes atomic.Int64
+	ttHits   atomic.Int64
+
+	// start is the time the search began.
+	start time.Time
+}
+
+// nodesBatch is the number of nodes a thread visits before flushing its
+// counter into the shared total and checking for cancellation.
+const nodesBatch = 1024
+
+// currMoveDelay is the time the search runs before reporting the root
+// move being searched.
+const currMoveDelay = time.Second
+
+// skipSize and skipPhase define the depth staggering of helper threads.
+// Helper i skips the iterations where
+// ((depth + skipPhase[i]) / skipSize[i]) is odd so that threads spread
+// across different depths instead of duplicating work.
+var (
+	skipSize  = [20]int{1, 1, 2, 2, 2, 2, 3, 3, 3, 3, 3, 3, 4, 4, 4, 4, 4, 4, 4, 4}
+	skipPhase = [20]int{0, 1, 0, 1, 2, 3, 0, 1, 2, 3, 4, 5, 0, 1, 2, 3, 4, 5, 6, 7}
+)
+
+// countNode accounts for a newly visited node. It returns an error when the
+// search must be aborted because the node budget was exhausted or the
+// context was cancelled.
+func (ctx *searchCtx) countNode() error {
+	ctx.nodes++
+	if ctx.nodes > ctx.maxNodes {
+		return errMaxNodesReached
+	}
+
+	if ctx.nodes%nodesBatch == 0 {
+		ctx.shared.qnodes.Add(ctx.qnodes)
+		ctx.shared.ttProbes.Add(ctx.ttProbes)
+		ctx.shared.ttHits.Add(ctx.ttHits)
+		ctx.qnodes, ctx.ttProbes, ctx.ttHits = 0, 0, 0
+
+		if ctx.shared.nodes.Add(nodesBatch) > ctx.maxNodes {
+			return errMaxNodesReached
+		}
+
+		select {
+		case <-ctx.Done():
+			return errContextCancelled
+		default:
+		}
+	}
+
+	return nil
+}
+
+// rootPosition returns a copy of p to search from. When the evaluator is
+// incremental, it is reset to p and attached to the copy.
+func (ctx *searchCtx) rootPosition(p *Position) *Position {
+	root := p.Copy()
+	if ctx.incremental != nil {
+		ctx.incremental.Reset(&root)
+		root.observer = ctx.incremental
+	}
+	return &root
+}
+
+// makeMove sets dst to position p after playing m, saving the state of the
+// incremental evaluator first. Every makeMove must be followed by an
+// unmakeMove once the move has been searched.
+func (ctx *searchCtx) makeMove(dst, p *Position, m Move) {
+	if ctx.incremental != nil {
+		ctx.incremental.Push()
+	}
+	// a plain copy, so the move notifies the incremental evaluator
+	*dst = *p
+	dst.Do(m)
+}
+
+// unmakeMove restores the state of the incremental evaluator saved by the
+// last makeMove.
+func (ctx *searchCtx) unmakeMove() {
+	if ctx.incremental != nil {
+		ctx.incremental.Pop()
+	}
+}
+
+// probeTT looks up p in the transposition table, keeping track of the hit
+// rate.
+func (ctx *searchCtx) probeTT(p *Position) (ttEntry, bool) {
+	entry, ok := ctx.tt.get(p.hash)
+	ctx.ttProbes++
+	if ok {
+		ctx.ttHits++
+	}
+	return entry, ok
+}
+
+// stats fills the search statistics of e. Counters not yet flushed by
+// other threads are not accounted for.
+func (ctx *searchCtx) stats(e *Evaluation) {
+	e.SelDepth = ctx.selDepth
+	e.Nodes = ctx.shared.nodes.Load() + ctx.nodes%nodesBatch
+	e.QNodes = ctx.shared.qnodes.Load() + ctx.qnodes
+	e.Time = time.Since(ctx.shared.start)
+
+	if e.Time > 0 {
+		e.NPS = int64(float64(e.Nodes) / e.Time.Seconds())
+	}
+
+	if ctx.tt != nil {
+		e.Hashfull = ctx.tt.Hashfull()
+	}
+
+	if probes := ctx.shared.ttProbes.Load() + ctx.ttProbes; probes > 0 {
+		e.TTHitRate = float64(ctx.shared.ttHits.Load()+ctx.ttHits) / float64(probes)
+	}
+}
+
+// isRepetition reports whether position p at ply is a draw by repetition.
+// A position repeated inside the search tree is scored as a draw right
+// away, while repetitions of positions played before the root require a
+// threefold repetition.
+func (ctx *searchCtx) isRepetition(p *Position, ply int) bool {
+	idx := ctx.root + ply
+	ctx.history[idx] = p.hash
+
+	count := 0
+	for i := idx - 2; i >= 0 && i >= idx-int(p.halfMoves); i -= 2 {
+		if ctx.history[i] == p.hash {
+			if i >= ctx.root {
+				return true
+			}
+
+			count++
+			if count == 2 {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// drawScore returns the score of a draw at ply taking contempt into account.
+func (ctx *searchCtx) drawScore(ply int) int {
+	if ply%2 == 0 {
+		return -ctx.contempt
+	}
+	return ctx.contempt
+}
+
+// kpkScore returns the exact score of a king and pawn against king
+// position from the KPK bitbase.
+func (ctx *searchCtx) kpkScore(p *Position, ply int) int {
+	if !ProbeKPK(p) {
+		return ctx.drawScore(ply)
+	}
+
+	strong := White
+	if p.pieces[Pawn]&p.allPieces[Black] != 0 {
+		strong = Black
+	}
+
+	score := evalKPK(p, strong)
+	if p.active != strong {
+		return -score
+	}
+	return score
+}
+
+// tbScore returns the score at ply of a position won or lost in dtm plies
+// according to the tablebase.
+func tbScore(wdl WDL, dtm, ply int) int {
+	if wdl == Loss {
+		return matedIn(ply + dtm)
+	}
+	return -matedIn(ply + dtm)
+}
+
+// updatePV makes m followed by the principal variation of the next ply the
+// principal variation at ply.
+func (ctx *searchCtx) updatePV(ply int, m Move) {
+	ctx.pv[ply][ply] = m
+	copy(ctx.pv[ply][ply+1:], ctx.pv[ply+1][ply+1:ctx.pvLen[ply+1]])
+	ctx.pvLen[ply] = ctx.pvLen[ply+1]
+}
+
+// skipDepth reports whether a helper thread should skip the iteration at
+// depth. The main thread never skips.
+func (ctx *searchCtx) skipDepth(depth int) bool {
+	if ctx.id == 0 {
+		return false
+	}
+	i := (ctx.id - 1) % len(skipSize)
+	return ((depth+skipPhase[i])/skipSize[i])%2 != 0
 }
 
 // SearchBestMove initiates an asynchronous search for the best move.
 // Returns a channel for evaluations and a function to cancel the search.
+// The channel is closed when the search ends and must be drained.
 func SearchBestMove(p *Position, opts *SearchOptions) (chan Evaluation, context.CancelFunc) {
 	if opts == nil {
 		opts = defaultSearchOptions
@@ -115,90 +482,414 @@ func SearchBestMove(p *Position, opts *SearchOptions) (chan Evaluation, context.
 	ch := make(chan Evaluation)
 	ctx, cancel := context.WithCancel(context.Background())
 
-	if opts.MaxTime != 0 {
-		ctx, cancel = context.WithTimeout(ctx, opts.MaxTime)
+	go func() {
+		defer close(ch)
+		Search(ctx, p, *opts, func(e Evaluation) {
+			ch <- e
+		})
+	}()
+
+	return ch, cancel
+}
+
+// Search looks for the best move in position p within the limits of opts
+// and returns the best line found. Every completed iteration is passed to
+// onIter, if not nil, from the goroutine calling Search.
+//
+// The search ends when a limit of opts is reached or ctx is done, either
+// way the best line found so far is returned. An error is only returned if
+// there is no move to play: [ErrNoMoves] when there are no legal moves to
+// search, [ErrNodeLimit] when MaxNodes ran out before any move was
+// searched, or the context error if the search was stopped, by ctx or by
+// MaxTime, before any move was searched.
+func Search(ctx context.Context, p *Position, opts SearchOptions, onIter func(Evaluation)) (Evaluation, error) {
+	if err := ctx.Err(); err != nil {
+		return Evaluation{}, err
 	}
 
-	if opts.MaxNodes == 0 {
-		opts.MaxNodes = math.MaxInt
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var tm *timeManager
+	if opts.SoftTime != 0 {
+		tm = newTimeManager(opts.SoftTime, opts.PonderHit != nil)
 	}
 
-	go func() {
-		defer close(ch)
+	if opts.PonderHit != nil {
+		// the clock only starts ticking on ponder hit
+		go func() {
+			select {
+			case <-opts.PonderHit:
+				if tm != nil {
+					tm.startClock()
+				}
+				if opts.MaxTime != 0 {
+					timer := time.AfterFunc(opts.MaxTime, cancel)
+					<-ctx.Done()
+					timer.Stop()
+				}
+			case <-ctx.Done():
+			}
+		}()
 
-		if entries, ok := book[p.hash]; ok {
-			move := pickMove(entries)
-			ch <- Evaluation{
-				Depth: 1,
-				Best:  move,
+		// while pondering the result is only final after the ponder hit
+		defer func() {
+			select {
+			case <-opts.PonderHit:
+			case <-ctx.Done():
 			}
-			return
+		}()
+	} else if opts.MaxTime != 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, opts.MaxTime)
+		defer cancelTimeout()
+	}
+
+	maxNodes := opts.MaxNodes
+	if maxNodes == 0 {
+		maxNodes = math.MaxInt64
+	}
+
+	maxDepth := opts.MaxDepth
+	if maxDepth <= 0 {
+		maxDepth = maxPly
+	}
+
+	var best Evaluation
+	report := func(e Evaluation) {
+		if e.MultiPV == 1 {
+			best = e
 		}
+		if onIter != nil {
+			onIter(e)
+		}
+	}
 
-		rootMoves := make([]Move, 0, 1024)
-		newPos := Position{}
+	if entries, ok := book[p.hash]; ok {
+		move := pickMove(entries)
+		report(Evaluation{
+			Depth:   1,
+			Best:    move,
+			PV:      []Move{move},
+			MultiPV: 1,
+		})
+		return best, nil
+	}
+
+	rootMoves := make([]Move, 0, 1024)
+	rootMoves, _ = LegalMoves(rootMoves, p)
+	if len(opts.Moves) > 0 {
+		rootMoves = filterMoves(rootMoves, opts.Moves)
+	}
+
+	if len(rootMoves) == 0 {
+		return best, ErrNoMoves
+	}
 
-		rootMoves, _ = LegalMoves(rootMoves, p)
-		if len(opts.Moves) > 0 {
-			rootMoves = filterMoves(rootMoves, opts.Moves)
+	if opts.Tablebase != nil {
+		if move, score, ok := tablebaseMove(opts.Tablebase, p, rootMoves, opts.Contempt); ok {
+			report(Evaluation{
+				Depth:   1,
+				Best:    move,
+				Score:   Score(score),
+				PV:      []Move{move},
+				MultiPV: 1,
+			})
+			return best, nil
 		}
+	}
+
+	var eval Evaluator
+	switch {
+	case opts.Evaluator != nil:
+		eval = opts.Evaluator
+	case opts.EvalFunc != nil:
+		eval = opts.EvalFunc
+	case opts.EvalParams != nil:
+		eval = NewPestoEvaluatorWithParams(opts.EvalParams)
+	default:
+		eval = NewPestoEvaluator()
+	}
+
+	if opts.TranspositionTable != nil {
+		opts.TranspositionTable.NewSearch()
+	}
 
-		count := len(rootMoves)
+	threads := max(opts.Threads, 1)
+	shared := &sharedSearch{start: time.Now()}
+	helpersCtx, stopHelpers := context.WithCancel(ctx)
+	defer stopHelpers()
 
-		searchCtx := &searchCtx{
+	ctxs := make([]*searchCtx, threads)
+	for i := range ctxs {
+		ctxs[i] = &searchCtx{
 			Context:  ctx,
-			maxNodes: opts.MaxNodes,
+			maxNodes: maxNodes,
 			tt:       opts.TranspositionTable,
+			eval:     eval,
+			qchecks:  opts.QuiescenceChecks,
+			tb:       opts.Tablebase,
+			history:  make([]uint64, len(opts.History)+maxPly+1),
+			root:     len(opts.History),
+			contempt: opts.Contempt,
+			shared:   shared,
+			id:       i,
 		}
+		if i == 0 {
+			ctxs[i].onCurrMove = opts.OnCurrMove
+			ctxs[i].tm = tm
+		}
+		copy(ctxs[i].history, opts.History)
+		ctxs[i].history[ctxs[i].root] = p.hash
 
-	loop:
-		// iterative deepening
-		for depth := 1; depth <= opts.MaxDepth; depth++ {
-			bestMoveAtDepth := Move(0)
-			bestScoreAtDepth := -Inf
-			alpha := -Inf
-			beta := Inf
+		if incremental, ok := eval.(IncrementalEvaluator); ok {
+			ctxs[i].incremental = incremental.Clone()
+			ctxs[i].eval = ctxs[i].incremental
+		}
+	}
 
-			// evaluate each root move
-			for _, m := range rootMoves {
+	// helper threads
+	var wg sync.WaitGroup
+	for _, helper := range ctxs[1:] {
+		helper.Context = helpersCtx
+		moves := make([]Move, len(rootMoves), 1024)
+		copy(moves, rootMoves)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			iterativeDeepening(helper, helper.rootPosition(p), moves, maxDepth, 1, nil)
+		}()
+	}
 
-				newPos = *p
-				newPos.Do(m)
+	mainThread := ctxs[0]
+	multiPV := max(opts.MultiPV, 1)
+	iterativeDeepening(mainThread, mainThread.rootPosition(p), rootMoves, maxDepth, multiPV, report)
+
+	stopHelpers()
+	wg.Wait()
+
+	// let the threads vote on the best move, only the main thread
+	// searches several lines
+	if multiPV == 1 {
+		if voted := voteBestMove(ctxs); voted != mainThread && voted.bestMove != mainThread.bestMove {
+			e := Evaluation{
+				Depth:   voted.depth,
+				Best:    voted.bestMove,
+				Score:   Score(voted.bestScore),
+				PV:      voted.bestPV,
+				MultiPV: 1,
+			}
+			mainThread.stats(&e)
+			report(e)
+		}
+	}
 
-				score, err := negamax(searchCtx, &newPos, rootMoves[count:], -beta, -alpha, depth-1, 1)
-				if err != nil {
-					break loop
-				}
-				score = -score
+	if best.Best == 0 {
+		if err := ctx.Err(); err != nil {
+			return best, err
+		}
+		// only the node limit aborts a search with the context alive
+		return best, ErrNodeLimit
+	}
+
+	return best, nil
+}
+
+// iterativeDeepening searches rootMoves of position p with increasing depth
+// until maxDepth is reached or the search is aborted. At every depth the
+// best multiPV lines are searched one after the other, each one excluding
+// the root moves of the lines already found. The best line of every
+// completed iteration is recorded in ctx and all the lines are passed to
+// report, if not nil.
+//
+// The moves of the previous iteration lines are searched first. So when
+// the search is aborted, any root move that was fully searched and beat
+// them is a better answer than the previous iteration, and it is recorded
+// and reported as well.
+func iterativeDeepening(ctx *searchCtx, p *Position, rootMoves []Move, maxDepth, multiPV int, report func(Evaluation)) {
+	if len(rootMoves) == 0 {
+		return
+	}
 
-				if score > bestScoreAtDepth {
-					bestScoreAtDepth = score
-					bestMoveAtDepth = m
+	lines := make([]Evaluation, 0, multiPV)
 
-					if score > alpha {
-						alpha = score
-					}
-				}
+	for depth := 1; depth <= maxDepth; depth++ {
+		if ctx.skipDepth(depth) {
+			continue
+		}
 
+		// try the best moves of the previous iteration first
+		for i := len(lines) - 1; i >= 0; i-- {
+			moveToFront(rootMoves, lines[i].Best)
+		}
+
+		lines = lines[:0]
+		ctx.selDepth = 0
+
+		var err error
+		for len(lines) < min(multiPV, len(rootMoves)) {
+			var best Move
+			var score int
+			best, score, err = searchRoot(ctx, p, rootMoves, lines, depth)
+
+			// an aborted search is only useful if a root move was
+			// fully searched
+			if best == 0 {
+				break
 			}
 
-			// inform the current evaluation
-			ch <- Evaluation{
-				Depth: depth,
-				Best:  bestMoveAtDepth,
-				Score: bestScoreAtDepth,
+			lines = append(lines, Evaluation{
+				Depth:   depth,
+				Best:    best,
+				Score:   Score(score),
+				PV:      ctx.completePV(p, slices.Clone(ctx.pv[0][:ctx.pvLen[0]])),
+				MultiPV: len(lines) + 1,
+			})
+
+			if err != nil {
+				break
 			}
+		}
 
-			// check for context cancellation
-			select {
-			case <-ctx.Done():
-				break loop
-			default:
+		if len(lines) == 0 {
+			return
+		}
+
+		for i := range lines {
+			ctx.stats(&lines[i])
+		}
+
+		ctx.depth = depth
+		ctx.bestMove = lines[0].Best
+		ctx.bestScore = int(lines[0].Score)
+		ctx.bestPV = lines[0].PV
+
+		// inform the current evaluation
+		if report != nil {
+			for _, line := range lines {
+				report(line)
 			}
 		}
-	}()
 
-	return ch, cancel
+		if err != nil {
+			return
+		}
+
+		if ctx.tm != nil && ctx.tm.stop(p, len(rootMoves), ctx.bestMove, ctx.bestScore) {
+			return
+		}
+
+		// check for context cancellation
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+	}
+}
+
+// searchRoot searches every root move at depth except the ones starting
+// the given lines. It returns the best move and its score, leaving its
+// principal variation in ctx. If the search is aborted, it returns the best
+// of the moves fully searched so far, if any, along with the error.
+func searchRoot(ctx *searchCtx, p *Position, rootMoves []Move, lines []Evaluation, depth int) (Move, int, error) {
+	var newPos Position
+	count := len(rootMoves)
+
+	bestMove := Move(0)
+	bestScore := -Inf
+	alpha := -Inf
+	beta := Inf
+	ctx.pvLen[0] = 0
+
+	// evaluate each root move
+	for i, m := range rootMoves {
+		if slices.ContainsFunc(lines, func(e Evaluation) bool { return e.Best == m }) {
+			continue
+		}
+
+		if ctx.onCurrMove != nil && time.Since(ctx.shared.start) > currMoveDelay {
+			ctx.onCurrMove(depth, m, i+1)
+		}
+
+		ctx.makeMove(&newPos, p, m)
+		score, err := negamax(ctx, &newPos, rootMoves[count:], -beta, -alpha, depth-1, 1)
+		ctx.unmakeMove()
+		if err != nil {
+			return bestMove, bestScore, err
+		}
+		score = -score
+
+		if score > bestScore {
+			bestScore = score
+			bestMove = m
+			ctx.updatePV(0, m)
+
+			if score > alpha {
+				alpha = score
+			}
+		}
+	}
+
+	return bestMove, bestScore, nil
+}
+
+// completePV extends a principal variation cut short by a transposition
+// table hit with the best reply stored in the table, so there is a move to
+// ponder on whenever possible.
+func (ctx *searchCtx) completePV(p *Position, pv []Move) []Move {
+	if ctx.tt == nil || len(pv) != 1 {
+		return pv
+	}
+
+	newPos := p.Copy()
+	newPos.Do(pv[0])
+
+	entry, ok := ctx.tt.get(newPos.hash)
+	if !ok || entry.move == 0 {
+		return pv
+	}
+
+	moves, _ := LegalMoves(nil, &newPos)
+	if slices.Contains(moves, entry.move) {
+		pv = append(pv, entry.move)
+	}
+
+	return pv
+}
+
+// voteBestMove picks the thread whose best move gathered the most votes.
+// Every thread votes for its best move with a weight that grows with the
+// depth it completed and with how good its score is relative to the other
+// threads. Ties are resolved in favour of the main thread.
+func voteBestMove(ctxs []*searchCtx) *searchCtx {
+	best := ctxs[0]
+	if len(ctxs) == 1 {
+		return best
+	}
+
+	minScore := Inf
+	for _, ctx := range ctxs {
+		if ctx.depth > 0 {
+			minScore = min(minScore, ctx.bestScore)
+		}
+	}
+
+	votes := make(map[Move]int64)
+	for _, ctx := range ctxs {
+		if ctx.depth > 0 {
+			votes[ctx.bestMove] += int64(ctx.bestScore-minScore+14) * int64(ctx.depth)
+		}
+	}
+
+	for _, ctx := range ctxs[1:] {
+		if ctx.depth > 0 && votes[ctx.bestMove] > votes[best.bestMove] {
+			best = ctx
+		}
+	}
+
+	return best
 }
 
 // filterMoves returns a subset of allMoves that are also present in wantMoves.
@@ -222,6 +913,35 @@ func filterMoves(allMoves []Move, wantMoves []Move) []Move {
 	return allMoves[:j]
 }
 
+// tablebaseMove returns the move of moves that keeps the best result of p
+// according to tb, the quickest mate when winning and the slowest when
+// losing, and its score. It returns false when p or one of the positions
+// reached isn't in tb.
+func tablebaseMove(tb *Tablebase, p *Position, moves []Move, contempt int) (Move, int, bool) {
+	if _, _, ok := tb.Probe(p); !ok {
+		return 0, 0, false
+	}
+
+	best, bestScore := Move(0), math.MinInt
+	for _, m := range moves {
+		child := p.Copy()
+		child.Do(m)
+		wdl, dtm, ok := tb.Probe(&child)
+		if !ok {
+			return 0, 0, false
+		}
+
+		score := -contempt
+		if wdl != Draw {
+			score = -tbScore(wdl, dtm, 1)
+		}
+		if score > bestScore {
+			best, bestScore = m, score
+		}
+	}
+	return best, bestScore, true
+}
+
 // negamax performs a recursive negamax search with Alpha-Beta pruning from
 // position p. It returns the best score achievable and the corresponding
 // move. alpha and beta are the current window bounds; depth is the remaining
@@ -234,24 +954,52 @@ func filterMoves(allMoves []Move, wantMoves []Move) []Move {
 // check. Both are handled before recursing so that eval is never called on
 // a terminal position.
 func negamax(ctx *searchCtx, p *Position, moves []Move, alpha, beta, depth, ply int) (int, error) {
+	ctx.pvLen[ply] = ply
+	ctx.selDepth = max(ctx.selDepth, ply)
 
-	// tranposition table enabled
-	var entry ttEntry
-	if ctx.tt != nil {
-		entry = ctx.tt.get(p.hash)
-		if entry.hash == p.hash && int(entry.depth) >= depth {
-			if entry.flag == exact {
-				return entry.score, nil
-			} else if entry.flag == lowerBound && entry.score >= beta {
-				return beta, nil
-			} else if entry.flag == upperBound && entry.score <= alpha {
-				return alpha, nil
+	if ply >= maxPly {
+		return ctx.eval.Evaluate(p), nil
+	}
+
+	if ctx.isRepetition(p, ply) {
+		return ctx.drawScore(ply), nil
+	}
+
+	// endgames in the tablebase are known exactly, no need to search
+	if ply > 0 && ctx.tb != nil {
+		if wdl, dtm, ok := ctx.tb.Probe(p); ok {
+			if wdl == Draw {
+				return ctx.drawScore(ply), nil
 			}
+			return tbScore(wdl, dtm, ply), nil
 		}
 	}
 
-	if depth == 0 {
-		return quiescence(ctx, p, moves, alpha, beta)
+	// king and pawn against king is known exactly, no need to search
+	if ply > 0 && isKPK(p) {
+		return ctx.kpkScore(p, ply), nil
+	}
+
+	if depth <= 0 {
+		return quiescence(ctx, p, moves, alpha, beta, 0, ply)
+	}
+
+	// tranposition table enabled
+	var ttMove Move
+	if ctx.tt != nil {
+		if entry, ok := ctx.probeTT(p); ok {
+			ttMove = entry.move
+			entry.score = scoreFromTT(entry.score, ply)
+			if entry.depth >= depth {
+				if entry.flag == exact {
+					return entry.score, nil
+				} else if entry.flag == lowerBound && entry.score >= beta {
+					return beta, nil
+				} else if entry.flag == upperBound && entry.score <= alpha {
+					return alpha, nil
+				}
+			}
+		}
 	}
 
 	moves, inCheck := LegalMoves(moves, p)
@@ -259,37 +1007,39 @@ func negamax(ctx *searchCtx, p *Position, moves []Move, alpha, beta, depth, ply
 
 	if count == 0 {
 		if inCheck {
-			return -MateScore + ply, nil
+			return matedIn(ply), nil
 		} else {
-			return 0, nil
+			return ctx.drawScore(ply), nil
 		}
 	}
 
+	// fifty-move rule, checkmate takes precedence
+	if p.halfMoves >= 100 {
+		return ctx.drawScore(ply), nil
+	}
+
+	// search the transposition table move first
+	if ttMove != 0 {
+		moveToFront(moves, ttMove)
+	}
+
 	originalAlpha := alpha
 	bestScore := -Inf
+	bestMove := Move(0)
 
 	var newPos Position
 
 	for _, m := range moves {
 
-		// abort if we exceed the number of nodes
-		ctx.nodes++
-		if ctx.nodes > ctx.maxNodes {
-			return 0, errMaxNodesReached
-		}
-
-		// abort if context has been cancelled
-		if ctx.nodes%2048 == 0 {
-			select {
-			case <-ctx.Done():
-				return 0, errContextCancelled
-			default:
-			}
+		// abort if we exceed the number of nodes or the context
+		// has been cancelled
+		if err := ctx.countNode(); err != nil {
+			return 0, err
 		}
 
-		newPos = *p
-		newPos.Do(m)
+		ctx.makeMove(&newPos, p, m)
 		score, err := negamax(ctx, &newPos, moves[count:], -beta, -alpha, depth-1, ply+1)
+		ctx.unmakeMove()
 
 		if err != nil {
 			return 0, err
@@ -299,10 +1049,12 @@ func negamax(ctx *searchCtx, p *Position, moves []Move, alpha, beta, depth, ply
 
 		if score > bestScore {
 			bestScore = score
+			bestMove = m
 		}
 
 		if score > alpha {
 			alpha = score
+			ctx.updatePV(ply, m)
 		}
 
 		if alpha >= beta {
@@ -319,64 +1071,126 @@ func negamax(ctx *searchCtx, p *Position, moves []Move, alpha, beta, depth, ply
 			flag = lowerBound
 		}
 
-		if entry.hash != p.hash || int(entry.depth) <= depth {
-			entry.hash = p.hash
-			entry.score = bestScore
-			entry.depth = depth
-			entry.flag = flag
-			ctx.tt.set(entry)
-		}
+		ctx.tt.set(p.hash, ttEntry{
+			move:  bestMove,
+			score: scoreToTT(bestScore, ply),
+			depth: depth,
+			flag:  flag,
+		})
 	}
 	return bestScore, nil
 }
 
+// moveToFront moves m to the beginning of moves, if present, shifting the
+// preceding moves one position to the right.
+func moveToFront(moves []Move, m Move) {
+	for i, move := range moves {
+		if move == m {
+			copy(moves[1:i+1], moves[:i])
+			moves[0] = m
+			return
+		}
+	}
+}
+
 // quiescence performs a restricted search that only considers "noisy" moves
-// (captures) until a "quiet" position is reached.
+// (captures and promotions) until a "quiet" position is reached.
 //
 // This is critical for avoiding the "Horizon Effect," where the engine
 // might misjudge a position because the main search depth ended
 // right in the middle of a piece exchange.
 //
+// depth is zero at the first quiescence ply and decreases from there. When
+// the side to move is in check all evasions are searched and standing pat is
+// not allowed. At the first ply quiet checks are also searched if enabled.
+// Captures that lose material according to the static exchange evaluator,
+// or that cannot raise the score up to alpha (delta pruning), are skipped.
+//
 // It returns a score that represents the settled value of the position.
 // If the search is interrupted by a timeout or node limit, it returns
 // an error to ensure the partial result is discarded.
-func quiescence(ctx *searchCtx, p *Position, moves []Move, alpha, beta int) (int, error) {
-	score := EvalPesto(p)
+func quiescence(ctx *searchCtx, p *Position, moves []Move, alpha, beta, depth, ply int) (int, error) {
+	ctx.pvLen[ply] = ply
+	ctx.selDepth = max(ctx.selDepth, ply)
 
-	if score >= beta {
-		return beta, nil
+	// tranposition table enabled
+	if ctx.tt != nil {
+		if entry, ok := ctx.probeTT(p); ok {
+			entry.score = scoreFromTT(entry.score, ply)
+			if entry.flag == exact {
+				return entry.score, nil
+			} else if entry.flag == lowerBound && entry.score >= beta {
+				return entry.score, nil
+			} else if entry.flag == upperBound && entry.score <= alpha {
+				return entry.score, nil
+			}
+		}
 	}
-	if score > alpha {
-		alpha = score
+
+	inCheck := p.InCheck()
+
+	if ply >= maxPly {
+		return ctx.eval.Evaluate(p), nil
+	}
+
+	originalAlpha := alpha
+	bestScore := -Inf
+	standPat := -Inf
+
+	if inCheck {
+		moves, _ = LegalMoves(moves, p)
+		if len(moves) == 0 {
+			return matedIn(ply), nil
+		}
+	} else {
+		standPat = ctx.eval.Evaluate(p)
+		if standPat >= beta {
+			return standPat, nil
+		}
+
+		bestScore = standPat
+		if standPat > alpha {
+			alpha = standPat
+		}
+
+		if depth == 0 && ctx.qchecks {
+			moves = noisyAndCheckingMoves(moves, p)
+		} else {
+			moves, _ = CaptureMoves(moves, p)
+		}
 	}
 
-	//FIXME: it should be captures and promotions
-	moves, _ = CaptureMoves(moves, p)
 	count := len(moves)
+	orderNoisyMoves(p, moves)
+
 	var newPos Position
 
 	for _, m := range moves {
 
-		// abort if max nodes
-		ctx.nodes++
-		ctx.qnodes++
-		if ctx.nodes > ctx.maxNodes {
-			return 0, errMaxNodesReached
-		}
+		if !inCheck && !m.IsPromotion() {
+			captured := capturedPiece(p, m)
 
-		// abort if context has been cancelled
-		if ctx.nodes%2048 == 0 {
-			select {
-			case <-ctx.Done():
-				return 0, errContextCancelled
-			default:
+			// delta pruning: even winning the captured piece for free
+			// will not bring the score up to alpha
+			if captured != Empty && standPat+seeValue[captured]+deltaMargin <= alpha {
+				continue
+			}
+
+			// skip exchanges that lose material
+			if see(p, m) < 0 {
+				continue
 			}
 		}
 
-		newPos = *p
-		newPos.Do(m)
+		// abort if max nodes or the context has been cancelled
+		ctx.qnodes++
+		if err := ctx.countNode(); err != nil {
+			return 0, err
+		}
 
-		score, err := quiescence(ctx, &newPos, moves[count:], -beta, -alpha)
+		ctx.makeMove(&newPos, p, m)
+		score, err := quiescence(ctx, &newPos, moves[count:], -beta, -alpha, depth-1, ply+1)
+		ctx.unmakeMove()
 
 		if err != nil {
 			return 0, err
@@ -384,15 +1198,90 @@ func quiescence(ctx *searchCtx, p *Position, moves []Move, alpha, beta int) (int
 
 		score = -score
 
-		if score >= beta {
-			return beta, nil
+		if score > bestScore {
+			bestScore = score
 		}
+
 		if score > alpha {
 			alpha = score
 		}
+
+		if alpha >= beta {
+			break
+		}
+	}
+
+	// transposition table enabled
+	if ctx.tt != nil {
+		flag := exact
+		if bestScore <= originalAlpha {
+			flag = upperBound
+		} else if bestScore >= beta {
+			flag = lowerBound
+		}
+
+		ctx.tt.set(p.hash, ttEntry{
+			score: scoreToTT(bestScore, ply),
+			depth: 0,
+			flag:  flag,
+		})
 	}
 
-	return alpha, nil
+	return bestScore, nil
+}
+
+// noisyAndCheckingMoves appends all legal captures and promotions plus the
+// quiet moves that give check to moves and returns the updated slice.
+func noisyAndCheckingMoves(moves []Move, p *Position) []Move {
+	moves, _ = LegalMoves(moves, p)
+
+	var newPos Position
+	var j int
+	for _, m := range moves {
+		if m.IsPromotion() || isCapture(p, m) {
+			moves[j] = m
+			j++
+			continue
+		}
+
+		newPos = p.Copy()
+		newPos.Do(m)
+		if newPos.InCheck() {
+			moves[j] = m
+			j++
+		}
+	}
+
+	return moves[:j]
+}
+
+// orderNoisyMoves sorts moves in place using the Most Valuable Victim /
+// Least Valuable Attacker heuristic so that the most promising captures are
+// searched first. Promotions are ranked by the promoted piece.
+func orderNoisyMoves(p *Position, moves []Move) {
+	var scores [256]int
+
+	if len(moves) > len(scores) {
+		return
+	}
+
+	for i, m := range moves {
+		score := seeValue[capturedPiece(p, m)]*16 - int(p.mailbox[m.From()])
+		if m.IsPromotion() {
+			score += seeValue[m.PromoPiece()] * 16
+		}
+		scores[i] = score
+	}
+
+	// insertion sort, the lists are short
+	for i := 1; i < len(moves); i++ {
+		m, score := moves[i], scores[i]
+		j := i - 1
+		for ; j >= 0 && scores[j] < score; j-- {
+			moves[j+1], scores[j+1] = moves[j], scores[j]
+		}
+		moves[j+1], scores[j+1] = m, score
+	}
 }
 
 // eval returns a static evaluation of position p in centipawns
@@ -442,182 +1331,15 @@ func pickMove(entries []bookEntry) Move {
 	return entries[len(entries)-1].Move
 }
 
-var mgValue = [Piece(6)]int{82, 337, 365, 477, 1025, 0}
-var egValue = [Piece(6)]int{94, 281, 297, 512, 936, 0}
-var mgTable [Color(2)][Piece(6)][64]int
-var egTable [Color(2)][Piece(6)][64]int
-
-var mgPawnTable = [64]int{
-	0, 0, 0, 0, 0, 0, 0, 0,
-	98, 134, 61, 95, 68, 126, 34, -11,
-	-6, 7, 26, 31, 65, 56, 25, -20,
-	-14, 13, 6, 21, 23, 12, 17, -23,
-	-27, -2, -5, 12, 17, 6, 10, -25,
-	-26, -4, -4, -10, 3, 3, 33, -12,
-	-35, -1, -20, -23, -15, 24, 38, -22,
-	0, 0, 0, 0, 0, 0, 0, 0,
-}
-
-var egPawnTable = [64]int{
-	0, 0, 0, 0, 0, 0, 0, 0,
-	178, 173, 158, 134, 147, 132, 165, 187,
-	94, 100, 85, 67, 56, 53, 82, 84,
-	32, 24, 13, 5, -2, 4, 17, 17,
-	13, 9, -3, -7, -7, -8, 3, -1,
-	4, 7, -6, 1, 0, -5, -1, -8,
-	13, 8, 8, 10, 13, 0, 2, -7,
-	0, 0, 0, 0, 0, 0, 0, 0,
-}
-
-var mgKnightTable = [64]int{
-	-167, -89, -34, -49, 61, -97, -15, -107,
-	-73, -41, 72, 36, 23, 62, 7, -17,
-	-47, 60, 37, 65, 84, 129, 73, 44,
-	-9, 17, 19, 53, 37, 69, 18, 22,
-	-13, 4, 16, 13, 28, 19, 21, -8,
-	-23, -9, 12, 10, 19, 17, 25, -16,
-	-29, -53, -12, -3, -1, 18, -14, -19,
-	-105, -21, -58, -33, -17, -28, -19, -23,
-}
-
-var egKnightTable = [64]int{
-	-58, -38, -13, -28, -31, -27, -63, -99,
-	-25, -8, -25, -2, -9, -25, -24, -52,
-	-24, -20, 10, 9, -1, -9, -19, -41,
-	-17, 3, 22, 22, 22, 11, 8, -18,
-	-18, -6, 16, 25, 16, 17, 4, -18,
-	-23, -3, -1, 15, 10, -3, -20, -22,
-	-42, -20, -10, -5, -2, -20, -23, -44,
-	-29, -51, -23, -15, -22, -18, -50, -64,
-}
-
-var mgBishopTable = [64]int{
-	-29, 4, -82, -37, -25, -42, 7, -8,
-	-26, 16, -18, -13, 30, 59, 18, -47,
-	-16, 37, 43, 40, 35, 50, 37, -2,
-	-4, 5, 19, 50, 37, 37, 7, -2,
-	-6, 13, 13, 26, 34, 12, 10, 4,
-	0, 15, 15, 15, 14, 27, 18, 10,
-	4, 15, 16, 0, 7, 21, 33, 1,
-	-33, -3, -14, -21, -13, -12, -39, -21,
-}
-
-var egBishopTable = [64]int{
-	-14, -21, -11, -8, -7, -9, -17, -24,
-	-8, -4, 7, -12, -3, -13, -4, -14,
-	2, -8, 0, -1, -2, 6, 0, 4,
-	-3, 9, 12, 9, 14, 10, 3, 2,
-	-6, 3, 13, 19, 7, 10, -3, -9,
-	-12, -3, 8, 10, 13, 3, -7, -15,
-	-14, -18, -7, -1, 4, -9, -15, -27,
-	-23, -9, -23, -5, -9, -16, -5, -17,
-}
-
-var mgRookTable = [64]int{
-	32, 42, 32, 51, 63, 9, 31, 43,
-	27, 32, 58, 62, 80, 67, 26, 44,
-	-5, 19, 26, 36, 17, 45, 61, 16,
-	-24, -11, 7, 26, 24, 35, -8, -20,
-	-36, -26, -12, -1, 9, -7, 6, -23,
-	-45, -25, -16, -17, 3, 0, -5, -33,
-	-44, -16, -20, -9, -1, 11, -6, -71,
-	-19, -13, 1, 17, 16, 7, -37, -26,
-}
-
-var egRookTable = [64]int{
-	13, 10, 18, 15, 12, 12, 8, 5,
-	11, 13, 13, 11, -3, 3, 8, 3,
-	7, 7, 7, 5, 4, -3, -5, -3,
-	4, 3, 13, 1, 2, 1, -1, 2,
-	3, 5, 8, 4, -5, -6, -8, -11,
-	-4, 0, -5, -1, -7, -12, -8, -16,
-	-6, -6, 0, 2, -9, -9, -11, -3,
-	-9, 2, 3, -1, -5, -13, 4, -20,
-}
-
-var mgQueenTable = [64]int{
-	-28, 0, 29, 12, 59, 44, 43, 45,
-	-24, -39, -5, 1, -16, 57, 28, 54,
-	-13, -17, 7, 8, 29, 56, 47, 57,
-	-27, -27, -16, -16, -1, 17, -2, 1,
-	-9, -26, -9, -10, -2, -4, 3, -3,
-	-14, 2, -11, -2, -5, 2, 14, 5,
-	-35, -8, 11, 2, 8, 15, -3, 1,
-	-1, -18, -9, 10, -15, -25, -31, -50,
-}
-
-var egQueenTable = [64]int{
-	-9, 22, 22, 27, 27, 19, 10, 20,
-	-17, 20, 32, 41, 58, 25, 30, 0,
-	-20, 6, 9, 49, 47, 35, 19, 9,
-	3, 22, 24, 45, 57, 40, 57, 36,
-	-18, 28, 19, 47, 31, 34, 39, 23,
-	-16, -27, 15, 6, 9, 17, 10, 5,
-	-22, -23, -30, -16, -16, -23, -36, -32,
-	-33, -28, -22, -43, -5, -32, -20, -41,
-}
-
-var mgKingTable = [64]int{
-	-65, 23, 16, -15, -56, -34, 2, 13,
-	29, -1, -20, -7, -8, -4, -38, -29,
-	-9, 24, 2, -16, -20, 6, 22, -22,
-	-17, -20, -12, -27, -30, -25, -14, -36,
-	-49, -1, -27, -39, -46, -44, -33, -51,
-	-14, -14, -22, -46, -44, -30, -15, -27,
-	1, 7, -8, -64, -43, -16, 9, 8,
-	-15, 36, 12, -54, 8, -28, 24, 14,
-}
-
-var egKingTable = [64]int{
-	-74, -35, -18, -18, -11, 15, 4, -17,
-	-12, 17, 14, 17, 17, 38, 23, 11,
-	10, 17, 23, 15, 20, 45, 44, 13,
-	-8, 22, 24, 27, 26, 33, 26, 3,
-	-18, -4, 21, 24, 27, 23, 9, -11,
-	-19, -3, 11, 21, 23, 16, 7, -9,
-	-27, -11, 4, 13, 14, 4, -5, -17,
-	-53, -34, -21, -11, -28, -14, -24, -43,
-}
-
-var mgPestoTable = [6][64]int{
-	mgPawnTable,
-	mgKnightTable,
-	mgBishopTable,
-	mgRookTable,
-	mgQueenTable,
-	mgKingTable,
-}
-
-var egPestoTable = [6][64]int{
-	egPawnTable,
-	egKnightTable,
-	egBishopTable,
-	egRookTable,
-	egQueenTable,
-	egKingTable,
-}
-
-var gamephaseInc = [6]int{0, 1, 1, 2, 4, 0}
-
-// FIXME: this should be moved to const.go and generated by
-// the const generator.
-func init() {
-	for p := range Piece(6) {
-		for sq := range Square(64) {
-			mgTable[White][p][sq] = mgValue[p] + mgPestoTable[p][int(sq)]
-			egTable[White][p][sq] = egValue[p] + egPestoTable[p][int(sq)]
-			mgTable[Black][p][sq] = mgValue[p] + mgPestoTable[p][int(sq^56)]
-			egTable[Black][p][sq] = egValue[p] + egPestoTable[p][int(sq^56)]
-		}
-	}
-}
+// pesto holds the tables of the default evaluation parameters.
+var pesto = DefaultEvalParams().compile()
 
 // EvalPesto calculates a static evaluation using the PeSTO method.
-// Returns a score in centipawns based on PST and game phase.
+// Returns a score in centipawns based on PST and game phase, adjusted for
+// material imbalance and drawish endgames by the material table.
 func EvalPesto(p *Position) int {
 	var mg [2]int
 	var eg [2]int
-	gamePhase := 0
 
 	mg[White] = 0
 	mg[Black] = 0
@@ -631,24 +1353,15 @@ func EvalPesto(p *Position) int {
 		piece := p.mailbox[sq]
 		if piece != Empty {
 			if bb&whiteBB != 0 {
-				mg[White] += mgTable[White][piece][sq]
-				eg[White] += egTable[White][piece][sq]
+				mg[White] += pesto.mg[White][piece][sq]
+				eg[White] += pesto.eg[White][piece][sq]
 			} else {
-				mg[Black] += mgTable[Black][piece][sq]
-				eg[Black] += egTable[Black][piece][sq]
+				mg[Black] += pesto.mg[Black][piece][sq]
+				eg[Black] += pesto.eg[Black][piece][sq]
 			}
-			gamePhase += gamephaseInc[piece]
 		}
 		bb <<= 1
 	}
 
-	mgScore := mg[p.active] - mg[p.inactive]
-	egScore := eg[p.active] - eg[p.inactive]
-	mgPhase := gamePhase
-	if mgPhase > 24 {
-		mgPhase = 24
-	}
-
-	egPhase := 24 - mgPhase
-	return (mgScore*mgPhase + egScore*egPhase) / 24
+	return pesto.taper(p, mg[White]-mg[Black], eg[White]-eg[Black])
 }
@@ -1,6 +1,9 @@
 package chester_test
 
 import (
+	"context"
+	"errors"
+	"slices"
 	"testing"
 	"time"
 
@@ -128,3 +131,598 @@ func TestSearchWithTT(t *testing.T) {
 		t.Errorf("Transposition table failed t1 (%s) < t2 (%s)", elapsedFirst, elapsedSecond)
 	}
 }
+
+func TestSearchBestMove_Quiescence(t *testing.T) {
+	tests := []struct {
+		name      string
+		fen       string
+		wantMove  string
+		avoidMove string
+	}{
+		{
+			// Taking the pawn loses the queen to the recapture
+			name:      "Avoid defended pawn",
+			fen:       "4k3/8/2p5/3p4/8/8/3Q4/4K3 w - - 0 1",
+			avoidMove: "d2d5",
+		},
+		{
+			// The undefended pawn is free
+			name:     "Take undefended pawn",
+			fen:      "4k3/8/8/3p4/8/8/3Q4/4K3 w - - 0 1",
+			wantMove: "d2d5",
+		},
+		{
+			// The knight is hanging but the pawn promotes
+			name:     "Promotion",
+			fen:      "7k/1P6/8/8/8/8/6n1/K7 w - - 0 1",
+			wantMove: "b7b8q",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p, _ := chester.ParseFEN(test.fen)
+			opts := &chester.SearchOptions{
+				MaxDepth:         1,
+				QuiescenceChecks: true,
+			}
+
+			ch, _ := chester.SearchBestMove(p, opts)
+
+			var lastEval chester.Evaluation
+			for e := range ch {
+				lastEval = e
+			}
+
+			if lastEval.Best == 0 {
+				t.Fatal("got no move")
+			}
+			if test.avoidMove != "" && lastEval.Best.String() == test.avoidMove {
+				t.Errorf("got move %s with score %d, want any other", lastEval.Best, lastEval.Score)
+			}
+			if test.wantMove != "" && lastEval.Best.String() != test.wantMove {
+				t.Errorf("got move %s, want %s", lastEval.Best, test.wantMove)
+			}
+		})
+	}
+}
+
+func TestSearchBestMove_QuiescenceEvasions(t *testing.T) {
+	tests := []struct {
+		name      string
+		fen       string
+		wantMove  string
+		wantScore func(chester.Score) bool
+	}{
+		{
+			// the capture mates, which the quiescence search finds with
+			// no evasions left
+			name:      "Mate",
+			fen:       "r1bqkb1r/pppp1ppp/2n2n2/4p2Q/2B1P3/8/PPPP1PPP/RNB1K1NR w KQkq - 0 1",
+			wantMove:  "h5f7",
+			wantScore: func(s chester.Score) bool { return s == chester.MateScore-1 },
+		},
+		{
+			// the capture forks king and queen: the king can't stand pat
+			// in check, and the queen falls after its evasion
+			name:      "Fork",
+			fen:       "2q3k1/4p3/8/3N4/8/8/6P1/6K1 w - - 0 1",
+			wantMove:  "d5e7",
+			wantScore: func(s chester.Score) bool { return s > 300 },
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p, _ := chester.ParseFEN(test.fen)
+			opts := &chester.SearchOptions{MaxDepth: 1}
+
+			ch, _ := chester.SearchBestMove(p, opts)
+
+			var lastEval chester.Evaluation
+			for e := range ch {
+				lastEval = e
+			}
+
+			if lastEval.Best.String() != test.wantMove || !test.wantScore(lastEval.Score) {
+				t.Errorf("got move %s with score %d, want %s", lastEval.Best, lastEval.Score, test.wantMove)
+			}
+		})
+	}
+}
+
+func TestQuiescence_DeltaPruning(t *testing.T) {
+	tests := []struct {
+		name         string
+		fen          string
+		alpha, beta  int
+		wantScore    int
+		wantSearched int64
+	}{
+		{
+			// once the knight is taken the pawn can't reach alpha
+			name:         "Full window",
+			fen:          "4k3/8/8/3p1n2/4P3/8/8/4K3 w - - 0 1",
+			alpha:        -chester.Inf,
+			beta:         chester.Inf,
+			wantScore:    0,
+			wantSearched: 1,
+		},
+		{
+			name:         "Out of reach",
+			fen:          "4k3/8/8/3p1n2/4P3/8/8/4K3 w - - 0 1",
+			alpha:        250,
+			beta:         chester.Inf,
+			wantScore:    -300,
+			wantSearched: 0,
+		},
+		{
+			name:         "Within the margin",
+			fen:          "4k3/8/8/3p4/4P3/8/8/4K3 w - - 0 1",
+			alpha:        250,
+			beta:         chester.Inf,
+			wantScore:    100,
+			wantSearched: 1,
+		},
+		{
+			name:         "Beyond the margin",
+			fen:          "4k3/8/8/3p4/4P3/8/8/4K3 w - - 0 1",
+			alpha:        300,
+			beta:         chester.Inf,
+			wantScore:    0,
+			wantSearched: 0,
+		},
+		{
+			// promotions are never pruned, not even to a knight
+			name:         "Promotion",
+			fen:          "8/1P6/4k3/8/8/8/8/4K3 w - - 0 1",
+			alpha:        500,
+			beta:         chester.Inf,
+			wantScore:    900,
+			wantSearched: 4,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p, _ := chester.ParseFEN(test.fen)
+			score, searched := chester.Quiescence(p, test.alpha, test.beta)
+			if score != test.wantScore || searched != test.wantSearched {
+				t.Errorf("got score %d with %d positions searched, want %d with %d",
+					score, searched, test.wantScore, test.wantSearched)
+			}
+		})
+	}
+}
+
+func TestSearchBestMove_EvalFunc(t *testing.T) {
+	p, _ := chester.ParseFEN("r1bqkb1r/pppp1ppp/2n2n2/4p2Q/2B1P3/8/PPPP1PPP/RNB1K1NR w KQkq - 0 1")
+
+	var calls int
+	opts := &chester.SearchOptions{
+		MaxDepth: 2,
+		EvalFunc: func(p *chester.Position) int {
+			calls++
+			return chester.EvalMaterial(p)
+		},
+	}
+
+	ch, _ := chester.SearchBestMove(p, opts)
+	for range ch {
+	}
+
+	if calls == 0 {
+		t.Errorf("EvalFunc was not called")
+	}
+}
+
+func TestSearchBestMove_Threads(t *testing.T) {
+	p, _ := chester.ParseFEN("r1bqkb1r/pppp1ppp/2n2n2/4p2Q/2B1P3/8/PPPP1PPP/RNB1K1NR w KQkq - 0 1")
+	opts := &chester.SearchOptions{
+		MaxDepth:           3,
+		Threads:            4,
+		TranspositionTable: chester.NewTranspositionTable(1024 * 1024),
+	}
+
+	ch, _ := chester.SearchBestMove(p, opts)
+
+	var lastEval chester.Evaluation
+	for e := range ch {
+		lastEval = e
+	}
+
+	if lastEval.Best.String() != "h5f7" {
+		t.Errorf("got move %s, want h5f7", lastEval.Best)
+	}
+}
+
+func TestSearchWithTT_MateDistance(t *testing.T) {
+	tt := chester.NewTranspositionTable(1024 * 1024)
+
+	// fill the table from the position one ply before, so the mate is
+	// found at a different distance from the root
+	p, _ := chester.ParseFEN("1k6/8/2K5/8/8/8/8/7R b - - 0 1")
+	m, _ := chester.ParseMove("b8a8", p)
+	ch, _ := chester.SearchBestMove(p, &chester.SearchOptions{
+		MaxDepth:           6,
+		Moves:              []chester.Move{m},
+		TranspositionTable: tt,
+	})
+	for range ch {
+	}
+
+	p, _ = chester.ParseFEN("k7/8/2K5/8/8/8/8/7R w - - 0 1")
+	ch, _ = chester.SearchBestMove(p, &chester.SearchOptions{
+		MaxDepth:           4,
+		TranspositionTable: tt,
+	})
+
+	for e := range ch {
+		if e.Score != chester.MateScore-3 {
+			t.Errorf("depth %d: got score %d, want %d", e.Depth, e.Score, chester.MateScore-3)
+		}
+
+		if got := e.Score.MateIn(); got != 2 {
+			t.Errorf("depth %d: got mate in %d, want mate in 2", e.Depth, got)
+		}
+	}
+}
+
+func TestSearchBestMove_FiftyMoveRule(t *testing.T) {
+	tests := []struct {
+		name     string
+		contempt int
+		want     chester.Score
+	}{
+		{name: "No contempt", contempt: 0, want: 0},
+		{name: "Contempt", contempt: 50, want: -50},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p, _ := chester.ParseFEN("7k/8/8/8/8/8/8/1Q5K w - - 99 80")
+			ch, _ := chester.SearchBestMove(p, &chester.SearchOptions{
+				MaxDepth: 3,
+				Contempt: test.contempt,
+			})
+
+			var lastEval chester.Evaluation
+			for e := range ch {
+				lastEval = e
+			}
+
+			if lastEval.Score != test.want {
+				t.Errorf("got score %d, want %d", lastEval.Score, test.want)
+			}
+		})
+	}
+}
+
+func TestSearchBestMove_Repetition(t *testing.T) {
+	p, _ := chester.ParseFEN("7k/8/8/8/8/8/8/KQ6 b - - 10 50")
+
+	// the position after Kg8 was already played twice
+	move, _ := chester.ParseMove("h8g8", p)
+	repeated := *p
+	repeated.Do(move)
+
+	ch, _ := chester.SearchBestMove(p, &chester.SearchOptions{
+		MaxDepth: 3,
+		History:  []uint64{1, repeated.Hash(), 2, repeated.Hash()},
+	})
+
+	var lastEval chester.Evaluation
+	for e := range ch {
+		lastEval = e
+	}
+
+	if lastEval.Best != move || lastEval.Score != 0 {
+		t.Errorf("got move %s score %d, want %s score 0", lastEval.Best, lastEval.Score, move)
+	}
+}
+
+func TestSearchBestMove_PV(t *testing.T) {
+	p, _ := chester.ParseFEN("r2q1rk1/ppp2ppp/2np1n2/2b1p1B1/2B1P1b1/2NP1N2/PPP2PPP/R2Q1RK1 w - - 0 8")
+	opts := &chester.SearchOptions{MaxDepth: 3}
+
+	ch, _ := chester.SearchBestMove(p, opts)
+
+	var lastEval chester.Evaluation
+	for e := range ch {
+		lastEval = e
+	}
+
+	if len(lastEval.PV) < 2 {
+		t.Fatalf("got pv %v, want at least 2 moves", lastEval.PV)
+	}
+
+	if lastEval.PV[0] != lastEval.Best {
+		t.Errorf("got pv starting with %s, want %s", lastEval.PV[0], lastEval.Best)
+	}
+
+	// every move of the pv must be legal in sequence
+	pos := *p
+	for _, m := range lastEval.PV {
+		moves, _ := chester.LegalMoves(nil, &pos)
+		if !slices.Contains(moves, m) {
+			t.Fatalf("pv %v: illegal move %s", lastEval.PV, m)
+		}
+		pos.Do(m)
+	}
+}
+
+func TestSearchBestMove_Ponder(t *testing.T) {
+	p, _ := chester.ParseFEN("r2q1rk1/ppp2ppp/2np1n2/2b1p1B1/2B1P1b1/2NP1N2/PPP2PPP/R2Q1RK1 w - - 0 8")
+	ponderHit := make(chan struct{})
+	opts := &chester.SearchOptions{
+		MaxDepth:  2,
+		MaxTime:   50 * time.Millisecond,
+		PonderHit: ponderHit,
+	}
+
+	ch, _ := chester.SearchBestMove(p, opts)
+
+	var lastEval chester.Evaluation
+	done := make(chan struct{})
+	go func() {
+		for e := range ch {
+			lastEval = e
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("search finished before ponderhit")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(ponderHit)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("search did not finish after ponderhit")
+	}
+
+	if lastEval.Best == 0 {
+		t.Error("got no best move")
+	}
+}
+
+func TestSearchBestMove_PonderStop(t *testing.T) {
+	p, _ := chester.ParseFEN("r2q1rk1/ppp2ppp/2np1n2/2b1p1B1/2B1P1b1/2NP1N2/PPP2PPP/R2Q1RK1 w - - 0 8")
+	opts := &chester.SearchOptions{
+		MaxDepth:  100,
+		MaxTime:   10 * time.Millisecond,
+		PonderHit: make(chan struct{}),
+	}
+
+	ch, cancel := chester.SearchBestMove(p, opts)
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	for range ch {
+	}
+
+	// the time limit must not apply until ponderhit
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("ponder search finished after %s, before stop", elapsed)
+	}
+}
+
+func TestSearchBestMove_MultiPV(t *testing.T) {
+	// exd5 wins the knight, every other move is worse
+	p, _ := chester.ParseFEN("4k3/8/8/3n4/4P3/8/8/R3K3 w - - 0 1")
+	opts := &chester.SearchOptions{
+		MaxDepth: 3,
+		MultiPV:  3,
+	}
+
+	ch, _ := chester.SearchBestMove(p, opts)
+
+	var lines []chester.Evaluation
+	for e := range ch {
+		if e.MultiPV == 1 {
+			lines = lines[:0]
+		}
+		lines = append(lines, e)
+	}
+
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want 3", len(lines))
+	}
+
+	if lines[0].Best.String() != "e4d5" {
+		t.Errorf("got best move %s, want e4d5", lines[0].Best)
+	}
+
+	seen := make(map[chester.Move]bool)
+	for i, line := range lines {
+		if line.MultiPV != i+1 {
+			t.Errorf("line %d: got multipv %d, want %d", i, line.MultiPV, i+1)
+		}
+
+		if i > 0 && line.Score > lines[i-1].Score {
+			t.Errorf("line %d: score %d better than previous line %d", i, line.Score, lines[i-1].Score)
+		}
+
+		if seen[line.Best] {
+			t.Errorf("line %d: move %s repeated", i, line.Best)
+		}
+		seen[line.Best] = true
+	}
+}
+
+func TestSearchBestMove_Stats(t *testing.T) {
+	p, _ := chester.ParseFEN("r2q1rk1/ppp2ppp/2np1n2/2b1p1B1/2B1P1b1/2NP1N2/PPP2PPP/R2Q1RK1 w - - 0 8")
+	opts := &chester.SearchOptions{
+		MaxDepth:           4,
+		TranspositionTable: chester.NewTranspositionTable(1024 * 1024),
+	}
+
+	ch, _ := chester.SearchBestMove(p, opts)
+
+	var lastNodes int64
+	for e := range ch {
+		if e.Nodes < lastNodes {
+			t.Errorf("depth %d: nodes decreased from %d to %d", e.Depth, lastNodes, e.Nodes)
+		}
+		lastNodes = e.Nodes
+
+		if e.Nodes == 0 || e.QNodes > e.Nodes {
+			t.Errorf("depth %d: got %d nodes and %d qnodes", e.Depth, e.Nodes, e.QNodes)
+		}
+
+		if e.SelDepth < e.Depth {
+			t.Errorf("depth %d: got seldepth %d", e.Depth, e.SelDepth)
+		}
+
+		if e.Time <= 0 || e.NPS <= 0 {
+			t.Errorf("depth %d: got time %s and nps %d", e.Depth, e.Time, e.NPS)
+		}
+
+		if e.Hashfull < 0 || e.Hashfull > 1000 {
+			t.Errorf("depth %d: got hashfull %d", e.Depth, e.Hashfull)
+		}
+
+		if e.TTHitRate < 0 || e.TTHitRate > 1 {
+			t.Errorf("depth %d: got tt hit rate %f", e.Depth, e.TTHitRate)
+		}
+	}
+
+	if lastNodes == 0 {
+		t.Error("got no evaluation")
+	}
+}
+
+func TestSearchBestMove_PartialIteration(t *testing.T) {
+	// depth 2 completes in about 15k nodes and depth 3 needs about 60k
+	p, _ := chester.ParseFEN("r2q1rk1/ppp2ppp/2np1n2/2b1p1B1/2B1P1b1/2NP1N2/PPP2PPP/R2Q1RK1 w - - 0 8")
+	opts := &chester.SearchOptions{
+		MaxDepth: 5,
+		MaxNodes: 40_000,
+	}
+
+	ch, _ := chester.SearchBestMove(p, opts)
+
+	var evals []chester.Evaluation
+	for e := range ch {
+		evals = append(evals, e)
+	}
+
+	if len(evals) < 3 {
+		t.Fatalf("got %d evaluations, want the aborted iteration reported", len(evals))
+	}
+
+	last := evals[len(evals)-1]
+	if last.Depth != 3 {
+		t.Errorf("got depth %d, want 3", last.Depth)
+	}
+
+	// the previous best move is searched first so it is always available
+	if prev := evals[len(evals)-2]; last.Best != prev.Best && last.Score <= prev.Score {
+		t.Errorf("got move %s (%d), want %s or a better move", last.Best, last.Score, prev.Best)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	p, _ := chester.ParseFEN("6k1/5ppp/8/8/8/8/5PPP/3R2K1 w - - 0 1")
+
+	var iterations []chester.Evaluation
+	best, err := chester.Search(context.Background(), p, chester.SearchOptions{MaxDepth: 3}, func(e chester.Evaluation) {
+		iterations = append(iterations, e)
+	})
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+
+	if best.Best.String() != "d1d8" {
+		t.Errorf("got move %s, want d1d8", best.Best)
+	}
+
+	if len(iterations) != 3 || iterations[2].Best != best.Best {
+		t.Errorf("got iterations %v, want 3 ending with the best move", iterations)
+	}
+}
+
+func TestSearch_Context(t *testing.T) {
+	p, _ := chester.ParseFEN("r2q1rk1/ppp2ppp/2np1n2/2b1p1B1/2B1P1b1/2NP1N2/PPP2PPP/R2Q1RK1 w - - 0 8")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	best, err := chester.Search(ctx, p, chester.SearchOptions{}, nil)
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("search ran for %s past the context deadline", elapsed)
+	}
+
+	if err != nil || best.Best == 0 {
+		t.Errorf("got move %s and error %v, want a move", best.Best, err)
+	}
+
+	// a context done before the search starts leaves no move to play
+	_, err = chester.Search(ctx, p, chester.SearchOptions{}, nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestSearch_NodeLimit(t *testing.T) {
+	p, _ := chester.ParseFEN("r2q1rk1/ppp2ppp/2np1n2/2b1p1B1/2B1P1b1/2NP1N2/PPP2PPP/R2Q1RK1 w - - 0 8")
+
+	best, err := chester.Search(context.Background(), p, chester.SearchOptions{MaxNodes: 2}, nil)
+	if !errors.Is(err, chester.ErrNodeLimit) {
+		t.Errorf("got move %s, error %v, want %v", best.Best, err, chester.ErrNodeLimit)
+	}
+
+	// enough nodes for a move
+	best, err = chester.Search(context.Background(), p, chester.SearchOptions{MaxNodes: 2_000}, nil)
+	if err != nil || best.Best == 0 {
+		t.Errorf("got move %s, error %v, want a move", best.Best, err)
+	}
+}
+
+func TestSearch_NoMoves(t *testing.T) {
+	p, _ := chester.ParseFEN("7k/6Q1/6K1/8/8/8/8/8 b - - 0 1")
+
+	_, err := chester.Search(context.Background(), p, chester.SearchOptions{MaxDepth: 3}, nil)
+	if !errors.Is(err, chester.ErrNoMoves) {
+		t.Errorf("got error %v, want %v", err, chester.ErrNoMoves)
+	}
+}
+
+func TestSearchBestMove_OptionsUnchanged(t *testing.T) {
+	p, _ := chester.ParseFEN("6k1/5ppp/8/8/8/8/5PPP/3R2K1 w - - 0 1")
+	opts := &chester.SearchOptions{MaxDepth: 2}
+
+	ch, _ := chester.SearchBestMove(p, opts)
+	for range ch {
+	}
+
+	if opts.MaxNodes != 0 {
+		t.Errorf("got MaxNodes %d, want options unchanged", opts.MaxNodes)
+	}
+}
+
+func TestSearchBestMove_Evaluator(t *testing.T) {
+	fens := []string{
+		"r2q1rk1/ppp2ppp/2np1n2/2b1p1B1/2B1P1b1/2NP1N2/PPP2PPP/R2Q1RK1 w - - 0 8",
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+	}
+
+	// the incremental evaluator must find exactly the same results as
+	// the evaluation function
+	for _, fen := range fens {
+		p, _ := chester.ParseFEN(fen)
+
+		want, _ := chester.Search(context.Background(), p, chester.SearchOptions{MaxDepth: 3, EvalFunc: chester.EvalPesto}, nil)
+		got, _ := chester.Search(context.Background(), p, chester.SearchOptions{MaxDepth: 3, Evaluator: chester.NewPestoEvaluator()}, nil)
+
+		if got.Best != want.Best || got.Score != want.Score || got.Nodes != want.Nodes {
+			t.Errorf("%s: got %s (%d) in %d nodes, want %s (%d) in %d nodes",
+				fen, got.Best, got.Score, got.Nodes, want.Best, want.Score, want.Nodes)
+		}
+	}
+}
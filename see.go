@@ -0,0 +1,122 @@
+package chester
+
+// seeValue holds the piece values used by the static exchange evaluator.
+// The king is given a large value so that it is always the last piece
+// considered for a recapture.
+var seeValue = [Piece(7)]int{100, 300, 300, 500, 900, 20000, 0}
+
+// pawnAttacks returns the set of squares attacked by the given pawns of
+// color.
+func pawnAttacks(color Color, pawns Bitboard) Bitboard {
+	leftAttacks := 16*int(color) - 9
+	rightAttacks := 16*int(color) - 7
+	return (pawns & File_Not_A).RotateLeft(leftAttacks) | (pawns & File_Not_H).RotateLeft(rightAttacks)
+}
+
+// attackersTo returns a Bitboard with every piece of either color that
+// attacks sq given the provided occupancy. Sliding attacks are computed
+// against occupied so that pieces removed from it reveal x-ray attackers.
+func attackersTo(p *Position, sq Square, occupied Bitboard) Bitboard {
+	bb := NewBitboardFromSquare(sq)
+	pawns := p.pieces[Pawn]
+
+	// a white pawn attacks sq when it would be attacked by a black pawn
+	// placed on sq, and vice versa
+	attackers := pawnAttacks(Black, bb) & pawns & p.allPieces[White]
+	attackers |= pawnAttacks(White, bb) & pawns & p.allPieces[Black]
+	attackers |= knightMoves[sq] & p.pieces[Knight]
+	attackers |= kingMoves[sq] & p.pieces[King]
+	attackers |= genBishopAttacks(sq, occupied) & (p.pieces[Bishop] | p.pieces[Queen])
+	attackers |= genRookAttacks(sq, occupied) & (p.pieces[Rook] | p.pieces[Queen])
+
+	return attackers & occupied
+}
+
+// isCapture reports whether m captures a piece in position p, including
+// en passant captures.
+func isCapture(p *Position, m Move) bool {
+	to := m.To()
+	return p.mailbox[to] != Empty ||
+		(to == p.enPassantTarget && p.mailbox[m.From()] == Pawn)
+}
+
+// capturedPiece returns the piece captured by m in position p or Empty when
+// m is not a capture. En passant captures are reported as pawns.
+func capturedPiece(p *Position, m Move) Piece {
+	to := m.To()
+	if p.mailbox[to] == Empty && to == p.enPassantTarget && p.mailbox[m.From()] == Pawn {
+		return Pawn
+	}
+	return p.mailbox[to]
+}
+
+// see performs a static exchange evaluation of move m in position p. It
+// returns the expected material balance, from the moving side perspective,
+// after all profitable recaptures on the destination square have been
+// played out with the least valuable attacker first.
+func see(p *Position, m Move) int {
+	from := m.From()
+	to := m.To()
+
+	var gain [32]int
+	depth := 0
+
+	occupied := p.Occupied()
+	attacker := p.mailbox[from]
+
+	gain[0] = seeValue[capturedPiece(p, m)]
+	if m.IsPromotion() {
+		attacker = m.PromoPiece()
+		gain[0] += seeValue[attacker] - seeValue[Pawn]
+	}
+
+	if attacker == Pawn && to == p.enPassantTarget && p.mailbox[to] == Empty {
+		if p.active == White {
+			occupied &^= NewBitboardFromSquare(to + 8)
+		} else {
+			occupied &^= NewBitboardFromSquare(to - 8)
+		}
+	}
+
+	occupied &^= NewBitboardFromSquare(from)
+	attackers := attackersTo(p, to, occupied)
+	side := p.inactive
+
+	for depth < len(gain)-1 {
+		sideAttackers := attackers & p.allPieces[side] & occupied
+		if sideAttackers == 0 {
+			break
+		}
+
+		// find the least valuable attacker
+		var next Piece
+		var bb Bitboard
+		for next = Pawn; next <= King; next++ {
+			bb = sideAttackers & p.pieces[next]
+			if bb != 0 {
+				break
+			}
+		}
+
+		// the king can only recapture if the square is no longer defended
+		if next == King && attackers&p.allPieces[side^1]&occupied != 0 {
+			break
+		}
+
+		depth++
+		gain[depth] = seeValue[attacker] - gain[depth-1]
+		attacker = next
+
+		sq, _ := bb.PopLSB()
+		occupied &^= NewBitboardFromSquare(sq)
+		attackers |= attackersTo(p, to, occupied)
+		side ^= 1
+	}
+
+	for depth > 0 {
+		gain[depth-1] = -max(-gain[depth-1], gain[depth])
+		depth--
+	}
+
+	return gain[0]
+}
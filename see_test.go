@@ -0,0 +1,45 @@
+package chester_test
+
+import (
+	"testing"
+
+	"github.com/bluescreen10/chester"
+)
+
+func TestSEE(t *testing.T) {
+	tests := []struct {
+		name string
+		fen  string
+		move string
+		want int
+	}{
+		{"free pawn", "4k3/8/8/3p4/4P3/8/8/4K3 w - - 0 1", "e4d5", 100},
+		{"free knight", "4k3/8/8/5n2/4P3/8/8/4K3 w - - 0 1", "e4f5", 300},
+		{"defended knight", "4k3/8/4p3/5n2/4P3/8/8/4K3 w - - 0 1", "e4f5", 200},
+		{"equal exchange", "4k3/2p5/3n4/8/4N3/8/8/4K3 w - - 0 1", "e4d6", 0},
+		{"defended pawn", "4k3/8/2p5/3p4/8/8/3Q4/4K3 w - - 0 1", "d2d5", -800},
+		{"defended rook", "3rk3/8/8/8/8/8/8/3QK3 w - - 0 1", "d1d8", -400},
+		{"rook for pawn", "3r2k1/3p4/8/8/8/8/3R4/4K3 w - - 0 1", "d2d7", -400},
+		{"x-ray attacker", "3r2k1/3p4/8/8/8/8/3R4/3RK3 w - - 0 1", "d2d7", 100},
+		{"x-ray defender", "3q2k1/3r4/8/3p4/8/8/3R4/3RK3 w - - 0 1", "d2d5", -400},
+		{"king recapture", "6k1/6p1/8/8/8/8/8/4K1R1 w - - 0 1", "g1g7", -400},
+		{"undefended king recapture", "6k1/6p1/8/8/8/8/6R1/4K1R1 w - - 0 1", "g2g7", 100},
+		{"en passant", "4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1", "e5d6", 100},
+		{"promotion", "4k3/1P6/8/8/8/8/8/4K3 w - - 0 1", "b7b8q", 800},
+		{"defended promotion", "1rk5/P7/8/8/8/8/8/4K3 w - - 0 1", "a7b8q", 400},
+	}
+
+	for _, test := range tests {
+		p, err := chester.ParseFEN(test.fen)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		m, err := chester.ParseMove(test.move, p)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if got := chester.SEE(p, m); got != test.want {
+			t.Errorf("%s: got %d, want %d", test.name, got, test.want)
+		}
+	}
+}
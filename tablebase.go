@@ -0,0 +1,808 @@
+package chester
+
+import (
+	"bufio"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// WDL is the result of a position with best play, from the point of view
+// of the side to move.
+type WDL int8
+
+const (
+	Loss WDL = -1
+	Draw WDL = 0
+	Win  WDL = 1
+)
+
+// String returns "loss", "draw" or "win".
+func (w WDL) String() string {
+	switch w {
+	case Loss:
+		return "loss"
+	case Win:
+		return "win"
+	default:
+		return "draw"
+	}
+}
+
+const (
+	// TablebaseMaxPieces is the largest number of pieces, kings included,
+	// of the endgames [Tablebase.Generate] builds.
+	TablebaseMaxPieces = 4
+
+	// tbMagic, tbVersion and tbExt identify the table files.
+	tbMagic   = "CHTB"
+	tbVersion = 1
+	tbExt     = ".ctb"
+
+	// tbPieceLetters maps the letters of the endgame codes to pieces.
+	tbPieceLetters = "PNBRQK"
+
+	// tbConvDraw marks the positions where a capture or a promotion
+	// reaches a draw while a table is generated.
+	tbConvDraw = 255
+
+	// maxTablebaseDTM is the longest distance to mate, in plies, a table
+	// value holds.
+	maxTablebaseDTM = 254
+)
+
+// ErrTablebaseCode is returned for an invalid endgame code.
+var ErrTablebaseCode = errors.New("invalid endgame code")
+
+// Tablebase holds distance to mate tables of endgames with up to
+// [TablebaseMaxPieces] pieces, built by retrograde analysis with
+// [Tablebase.Generate] or read from disk with [Tablebase.Load].
+//
+// Probe is safe for concurrent use, Generate and Load are not.
+type Tablebase struct {
+	// tables maps the material hash of the positions of both colors to
+	// their table. flip is set for the positions with the colors swapped.
+	tables map[uint64]tbEntry
+
+	// maxPieces is the number of pieces of the largest table.
+	maxPieces int
+}
+
+type tbEntry struct {
+	table *tbTable
+	flip  bool
+}
+
+// tbPiece is a piece of a table, the stronger side is always white.
+type tbPiece struct {
+	piece Piece
+	color Color
+}
+
+// tbTable is the table of one endgame. Positions are indexed by the
+// square of the white king, reduced by symmetry, the squares of the other
+// pieces and the side to move. Values are one byte: 0 for draws and
+// illegal positions, odd v for a loss and even v for a win, in v-1 plies.
+type tbTable struct {
+	code   string
+	pieces []tbPiece
+	pawns  bool
+	data   []uint8
+}
+
+// King squares and symmetries of the tables. Without pawns the white king
+// is kept in the a1-d1-d4 triangle using the 8 symmetries of the board,
+// with pawns it is kept on files a to d mirroring the board left to right.
+var (
+	tbKingIndex   [2][64]int8
+	tbKingSquares [2][]Square
+)
+
+func init() {
+	for pawns := range 2 {
+		for sq := range Square(64) {
+			rank, file := sq.RankAndFile()
+			tbKingIndex[pawns][sq] = -1
+			if file <= 3 && (pawns == 1 || rank <= file) {
+				tbKingIndex[pawns][sq] = int8(len(tbKingSquares[pawns]))
+				tbKingSquares[pawns] = append(tbKingSquares[pawns], sq)
+			}
+		}
+	}
+}
+
+// tbTransform returns sq transformed by the symmetry sym: bit 0 mirrors
+// the files, bit 1 the ranks and bit 2 transposes the board along the
+// a1-h8 diagonal.
+func tbTransform(sq Square, sym int) Square {
+	if sym&4 != 0 {
+		row, file := sq>>3, sq&7
+		sq = (7-file)*8 + 7 - row
+	}
+	if sym&1 != 0 {
+		sq ^= 7
+	}
+	if sym&2 != 0 {
+		sq ^= 56
+	}
+	return sq
+}
+
+// NewTablebase returns an empty tablebase. Positions with only the two
+// kings are always known to be drawn.
+func NewTablebase() *Tablebase {
+	return &Tablebase{tables: map[uint64]tbEntry{}, maxPieces: 2}
+}
+
+// Probe returns the result of p with best play and its distance to mate in
+// plies, both from the point of view of the side to move. It returns ok
+// false when p isn't covered by the tablebase, which includes positions
+// with castling rights or an en passant capture. The fifty-move rule is
+// ignored.
+func (tb *Tablebase) Probe(p *Position) (wdl WDL, dtm int, ok bool) {
+	if p.Occupied().OnesCount() > tb.maxPieces || p.castlingRights != 0 {
+		return Draw, 0, false
+	}
+
+	if ep := p.enPassantTarget; ep != SQ_NULL {
+		pawnSq := ep - 8
+		if p.active == White {
+			pawnSq = ep + 8
+		}
+		if p.adjacentPawns(p.active, pawnSq) {
+			return Draw, 0, false
+		}
+	}
+
+	v, ok := tb.value(p)
+	if !ok {
+		return Draw, 0, false
+	}
+	wdl, dtm = tbDecode(v)
+	return wdl, dtm, true
+}
+
+// Codes returns the codes of the endgames in the tablebase, sorted.
+func (tb *Tablebase) Codes() []string {
+	var codes []string
+	for _, e := range tb.tables {
+		codes = append(codes, e.table.code)
+	}
+	slices.Sort(codes)
+	return slices.Compact(codes)
+}
+
+// tbDecode returns the result and distance to mate of a table value.
+func tbDecode(v uint8) (WDL, int) {
+	switch {
+	case v == 0:
+		return Draw, 0
+	case v%2 == 1:
+		return Loss, int(v) - 1
+	default:
+		return Win, int(v) - 1
+	}
+}
+
+// value returns the table value of p, which has no castling rights, and
+// whether a table covers it.
+func (tb *Tablebase) value(p *Position) (uint8, bool) {
+	if p.Occupied().OnesCount() == 2 {
+		return 0, true
+	}
+
+	e, ok := tb.tables[p.materialHash]
+	if !ok {
+		return 0, false
+	}
+
+	var sqs [TablebaseMaxPieces]Square
+	stm := e.table.squares(p, e.flip, sqs[:])
+	return e.table.data[e.table.index(stm, sqs[:len(e.table.pieces)])], true
+}
+
+// add registers t for the positions of both colors.
+func (tb *Tablebase) add(t *tbTable) {
+	tb.tables[endgameKey(t.code, Black)] = tbEntry{t, true}
+	tb.tables[endgameKey(t.code, White)] = tbEntry{t, false}
+	tb.maxPieces = max(tb.maxPieces, len(t.pieces))
+}
+
+// Generate builds the table of the endgame described by code, the pieces
+// of one side followed by those of the other, each starting with its king,
+// like "KQKR". The tables of the endgames reached by captures and
+// promotions are built first. Tables already in the tablebase are kept.
+//
+// En passant captures are not considered while generating, so the rare
+// positions where one would follow a double pawn push may be off.
+func (tb *Tablebase) Generate(code string) error {
+	canonical, pieces, err := parseTablebaseCode(code)
+	if err != nil {
+		return err
+	}
+	if len(pieces) == 2 {
+		return nil
+	}
+	if _, ok := tb.tables[endgameKey(canonical, White)]; ok {
+		return nil
+	}
+
+	for _, sub := range subEndgames(canonical) {
+		if err := tb.Generate(sub); err != nil {
+			return err
+		}
+	}
+
+	t := newTBTable(canonical, pieces)
+	if err := t.generate(tb); err != nil {
+		return err
+	}
+	tb.add(t)
+	return nil
+}
+
+// parseTablebaseCode validates code and returns it in canonical form, with
+// the pieces of each side sorted from the king to the pawns and the
+// stronger side first, along with the pieces of its table.
+func parseTablebaseCode(code string) (string, []tbPiece, error) {
+	code = strings.ToUpper(code)
+	i := strings.LastIndexByte(code, 'K')
+	if i <= 0 || code[0] != 'K' || len(code) > TablebaseMaxPieces {
+		return "", nil, fmt.Errorf("%w: %s", ErrTablebaseCode, code)
+	}
+
+	sides := [2]string{code[:i], code[i:]}
+	var strength [2]int
+	for s, side := range sides {
+		b := []byte(side)
+		for _, c := range b[1:] {
+			piece := strings.IndexByte(tbPieceLetters, c)
+			if piece < 0 || Piece(piece) == King {
+				return "", nil, fmt.Errorf("%w: %s", ErrTablebaseCode, code)
+			}
+			strength[s] += egValue[piece]
+		}
+		slices.SortFunc(b, func(x, y byte) int {
+			return strings.IndexByte(tbPieceLetters, y) - strings.IndexByte(tbPieceLetters, x)
+		})
+		sides[s] = string(b)
+	}
+
+	if strength[1] > strength[0] || strength[1] == strength[0] && sides[1] > sides[0] {
+		sides[0], sides[1] = sides[1], sides[0]
+	}
+
+	pieces := []tbPiece{{King, White}, {King, Black}}
+	for color, side := range sides {
+		for _, c := range side[1:] {
+			pieces = append(pieces, tbPiece{Piece(strings.IndexByte(tbPieceLetters, byte(c))), Color(color)})
+		}
+	}
+	return sides[0] + sides[1], pieces, nil
+}
+
+// subEndgames returns the codes of the endgames reached from code by a
+// capture or a promotion.
+func subEndgames(code string) []string {
+	var subs []string
+	for i := 1; i < len(code); i++ {
+		switch code[i] {
+		case 'K':
+		case 'P':
+			for _, promo := range "QRBN" {
+				subs = append(subs, code[:i]+string(promo)+code[i+1:])
+			}
+			fallthrough
+		default:
+			subs = append(subs, code[:i]+code[i+1:])
+		}
+	}
+	return subs
+}
+
+// newTBTable returns the empty table of the endgame code, with pieces.
+func newTBTable(code string, pieces []tbPiece) *tbTable {
+	t := &tbTable{code: code, pieces: pieces}
+	for _, pc := range pieces {
+		t.pawns = t.pawns || pc.piece == Pawn
+	}
+
+	size := len(tbKingSquares[t.kingSet()]) * 2
+	for range pieces[1:] {
+		size *= 64
+	}
+	t.data = make([]uint8, size)
+	return t
+}
+
+// kingSet returns the index of the king squares and the number of
+// symmetries of the table.
+func (t *tbTable) kingSet() int {
+	if t.pawns {
+		return 1
+	}
+	return 0
+}
+
+// index returns the index of the position with stm to move and the pieces
+// of the table on sqs. It is the same for all the symmetric positions.
+func (t *tbTable) index(stm Color, sqs []Square) int {
+	symmetries := 8
+	if t.pawns {
+		symmetries = 2
+	}
+
+	best := -1
+	var buf [TablebaseMaxPieces]Square
+	for sym := range symmetries {
+		k := tbKingIndex[t.kingSet()][tbTransform(sqs[0], sym)]
+		if k < 0 {
+			continue
+		}
+
+		for i, sq := range sqs {
+			buf[i] = tbTransform(sq, sym)
+		}
+		// identical pieces in ascending order
+		for i := 3; i < len(sqs); i++ {
+			for j := i; j > 2 && t.pieces[j] == t.pieces[j-1] && buf[j] < buf[j-1]; j-- {
+				buf[j], buf[j-1] = buf[j-1], buf[j]
+			}
+		}
+
+		index := int(k)
+		for _, sq := range buf[1:len(sqs)] {
+			index = index*64 + int(sq)
+		}
+		index = index*2 + int(stm)
+
+		if best < 0 || index < best {
+			best = index
+		}
+	}
+	return best
+}
+
+// decode returns the side to move and the squares of the pieces of the
+// position at index.
+func (t *tbTable) decode(index int, sqs []Square) Color {
+	stm := Color(index & 1)
+	index >>= 1
+	for i := len(t.pieces) - 1; i > 0; i-- {
+		sqs[i] = Square(index & 63)
+		index >>= 6
+	}
+	sqs[0] = tbKingSquares[t.kingSet()][index]
+	return stm
+}
+
+// squares fills sqs with the squares of the pieces of the table in p, with
+// the colors swapped when flip is set, and returns the side to move.
+func (t *tbTable) squares(p *Position, flip bool, sqs []Square) Color {
+	var swap Color
+	var mirror Square
+	if flip {
+		swap, mirror = 1, 56
+	}
+
+	var bb Bitboard
+	for i, pc := range t.pieces {
+		if i == 0 || pc != t.pieces[i-1] {
+			bb = p.pieces[pc.piece] & p.allPieces[pc.color^swap]
+		}
+		var sq Square
+		sq, bb = bb.PopLSB()
+		sqs[i] = sq ^ mirror
+	}
+	return p.active ^ swap
+}
+
+// position returns the position with stm to move and the pieces of the
+// table on sqs.
+func (t *tbTable) position(stm Color, sqs []Square) *Position {
+	p := &Position{
+		enPassantTarget: SQ_NULL,
+		active:          stm,
+		inactive:        stm ^ 1,
+		fullMoves:       1,
+	}
+	for sq := range p.mailbox {
+		p.mailbox[sq] = Empty
+	}
+	for i, pc := range t.pieces {
+		p.put(pc.piece, pc.color, sqs[i])
+	}
+	p.hash = computeHash(p)
+	return p
+}
+
+// legal returns the position at index, or nil if it is illegal or another
+// index holds it.
+func (t *tbTable) legal(index int) *Position {
+	var sqs [TablebaseMaxPieces]Square
+	stm := t.decode(index, sqs[:])
+	n := len(t.pieces)
+
+	var occupied Bitboard
+	for i, sq := range sqs[:n] {
+		bb := NewBitboardFromSquare(sq)
+		if occupied&bb != 0 || t.pieces[i].piece == Pawn && (sq < 8 || sq >= 56) {
+			return nil
+		}
+		occupied |= bb
+	}
+
+	if squareDistance(sqs[0], sqs[1]) <= 1 || t.index(stm, sqs[:n]) != index {
+		return nil
+	}
+
+	p := t.position(stm, sqs[:n])
+	if attackersTo(p, sqs[stm^1], occupied)&p.allPieces[stm] != 0 {
+		return nil
+	}
+	return p
+}
+
+// generate fills the table by retrograde analysis. Captures and promotions
+// are resolved first from the tables of tb. Then, from the mates, the
+// predecessors of the positions lost in n plies are won in n+1 and those
+// whose moves all reach won positions are lost.
+func (t *tbTable) generate(tb *Tablebase) error {
+	size := len(t.data)
+	count := make([]uint8, size)
+	conv := make([]uint8, size)
+
+	workers := runtime.GOMAXPROCS(0)
+	chunk := (size + workers - 1) / workers
+	errs := make([]error, workers)
+
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			moves := make([]Move, 0, 256)
+			for index := w * chunk; index < min(size, (w+1)*chunk); index++ {
+				if errs[w] = t.initialize(tb, index, moves, count, conv); errs[w] != nil {
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	maxDepth := 0
+	for index := range size {
+		if v := max(t.data[index], conv[index]); v != tbConvDraw {
+			maxDepth = max(maxDepth, int(v)-1)
+		}
+	}
+
+	var preds []int
+	var sqs [TablebaseMaxPieces]Square
+	for n := 0; n <= maxDepth; n++ {
+		v := uint8(n + 1)
+
+		// wins by capture or promotion not beaten by a quicker one
+		if n%2 == 1 {
+			for index, c := range conv {
+				if c == v && t.data[index] == 0 {
+					t.data[index] = v
+				}
+			}
+		}
+
+		for index, value := range t.data {
+			if value != v {
+				continue
+			}
+
+			stm := t.decode(index, sqs[:])
+			preds = t.predecessors(stm, sqs[:len(t.pieces)], preds[:0])
+			for _, pred := range preds {
+				if t.data[pred] != 0 {
+					continue
+				}
+
+				depth := n + 1
+				if n%2 == 1 {
+					// a losing move, the position is lost when all are
+					// and no capture or promotion saves it
+					if count[pred]--; count[pred] > 0 {
+						continue
+					}
+					c := conv[pred]
+					if c == tbConvDraw || c != 0 && c%2 == 0 {
+						continue
+					}
+					if c != 0 {
+						depth = max(depth, int(c)-1)
+					}
+				}
+
+				if depth >= tbConvDraw-1 {
+					return fmt.Errorf("%s: distance to mate over %d plies", t.code, tbConvDraw-2)
+				}
+				t.data[pred] = uint8(depth + 1)
+				maxDepth = max(maxDepth, depth)
+			}
+		}
+	}
+	return nil
+}
+
+// initialize sets the value of the position at index when it is mate or
+// only has captures and promotions, and otherwise its number of distinct
+// successors in the table in count and the best result of its captures
+// and promotions in conv.
+func (t *tbTable) initialize(tb *Tablebase, index int, moves []Move, count, conv []uint8) error {
+	p := t.legal(index)
+	if p == nil {
+		return nil
+	}
+
+	moves, inCheck := LegalMoves(moves[:0], p)
+	if len(moves) == 0 {
+		if inCheck {
+			t.data[index] = 1
+		}
+		return nil
+	}
+
+	var children [64]int
+	var sqs [TablebaseMaxPieces]Square
+	n, best := 0, uint8(0)
+	for _, m := range moves {
+		child := p.Copy()
+		child.Do(m)
+
+		if child.materialHash == p.materialHash {
+			stm := t.squares(&child, false, sqs[:])
+			c := t.index(stm, sqs[:len(t.pieces)])
+			if !slices.Contains(children[:n], c) {
+				children[n] = c
+				n++
+			}
+			continue
+		}
+
+		v, ok := tb.value(&child)
+		if !ok {
+			return fmt.Errorf("%s: missing table for %s", t.code, child.FEN())
+		}
+		if v == 0 {
+			v = tbConvDraw
+		} else {
+			v++
+		}
+		if tbConvRank(v) > tbConvRank(best) {
+			best = v
+		}
+	}
+
+	if n == 0 {
+		if best != tbConvDraw {
+			t.data[index] = best
+		}
+		return nil
+	}
+	count[index], conv[index] = uint8(n), best
+	return nil
+}
+
+// tbConvRank orders the results of captures and promotions from the
+// point of view of the side making them: quicker wins first, then draws,
+// then slower losses.
+func tbConvRank(v uint8) int {
+	switch {
+	case v == 0:
+		return -1000
+	case v == tbConvDraw:
+		return 0
+	case v%2 == 0:
+		return 1000 - int(v)
+	default:
+		return -1000 + int(v)
+	}
+}
+
+// predecessors appends to preds the distinct indexes of the positions in
+// the table that reach the position with stm to move and the pieces on
+// sqs by a move other than a capture or a promotion.
+func (t *tbTable) predecessors(stm Color, sqs []Square, preds []int) []int {
+	mover := stm ^ 1
+
+	var occupied Bitboard
+	for _, sq := range sqs {
+		occupied |= NewBitboardFromSquare(sq)
+	}
+
+	var prev [TablebaseMaxPieces]Square
+	for i, pc := range t.pieces {
+		if pc.color != mover {
+			continue
+		}
+
+		from := sqs[i]
+		var bb Bitboard
+		switch pc.piece {
+		case King:
+			bb = kingMoves[from]
+		case Knight:
+			bb = knightMoves[from]
+		case Bishop:
+			bb = genBishopAttacks(from, occupied)
+		case Rook:
+			bb = genRookAttacks(from, occupied)
+		case Queen:
+			bb = genBishopAttacks(from, occupied) | genRookAttacks(from, occupied)
+		case Pawn:
+			bb = pawnUnpushes(mover, from, occupied)
+		}
+		bb &^= occupied
+
+		for bb != 0 {
+			var to Square
+			to, bb = bb.PopLSB()
+			copy(prev[:], sqs)
+			prev[i] = to
+
+			if pc.piece == King && squareDistance(prev[0], prev[1]) <= 1 {
+				continue
+			}
+
+			// the side to move can't be in check before the move
+			p := t.position(mover, prev[:len(sqs)])
+			if attackersTo(p, prev[stm], p.Occupied())&p.allPieces[mover] != 0 {
+				continue
+			}
+
+			if index := t.index(mover, prev[:len(sqs)]); !slices.Contains(preds, index) {
+				preds = append(preds, index)
+			}
+		}
+	}
+	return preds
+}
+
+// pawnUnpushes returns the squares a pawn of color on sq could have been
+// pushed from, given the occupied squares.
+func pawnUnpushes(color Color, sq Square, occupied Bitboard) Bitboard {
+	var bb Bitboard
+	rank := relativeRank(color, sq)
+	back := Square(8)
+	if color == Black {
+		back = -8
+	}
+
+	if rank >= 2 {
+		bb |= NewBitboardFromSquare(sq + back)
+	}
+	if rank == 3 && occupied&NewBitboardFromSquare(sq+back) == 0 {
+		bb |= NewBitboardFromSquare(sq + 2*back)
+	}
+	return bb
+}
+
+// Save writes every table of tb to dir, one file per endgame named after
+// its code. Each file holds a header, with the magic "CHTB", the format
+// version, the code and the number of positions, followed by the values
+// of the positions compressed with DEFLATE.
+func (tb *Tablebase) Save(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	for _, code := range tb.Codes() {
+		t := tb.tables[endgameKey(code, White)].table
+		if err := t.save(filepath.Join(dir, code+tbExt)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// save writes t to the file name.
+func (t *tbTable) save(name string) (err error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	w := bufio.NewWriter(f)
+	w.WriteString(tbMagic)
+	w.WriteByte(tbVersion)
+	w.WriteByte(byte(len(t.code)))
+	w.WriteString(t.code)
+	binary.Write(w, binary.LittleEndian, uint32(len(t.data)))
+
+	zw, err := flate.NewWriter(w, flate.BestCompression)
+	if err != nil {
+		return err
+	}
+	if _, err := zw.Write(t.data); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// Load reads the tables in the files of dir written by [Tablebase.Save].
+func (tb *Tablebase) Load(dir string) error {
+	if _, err := os.Stat(dir); err != nil {
+		return err
+	}
+
+	names, err := filepath.Glob(filepath.Join(dir, "*"+tbExt))
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		t, err := loadTBTable(name)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		tb.add(t)
+	}
+	return nil
+}
+
+// loadTBTable reads the table in the file name.
+func loadTBTable(name string) (*tbTable, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	header := make([]byte, len(tbMagic)+2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if string(header[:len(tbMagic)]) != tbMagic || header[len(tbMagic)] != tbVersion {
+		return nil, errors.New("not a tablebase file")
+	}
+
+	code := make([]byte, header[len(tbMagic)+1])
+	if _, err := io.ReadFull(r, code); err != nil {
+		return nil, err
+	}
+	canonical, pieces, err := parseTablebaseCode(string(code))
+	if err != nil {
+		return nil, err
+	}
+
+	var size uint32
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return nil, err
+	}
+
+	t := newTBTable(canonical, pieces)
+	if int(size) != len(t.data) {
+		return nil, fmt.Errorf("%s: got %d positions, want %d", canonical, size, len(t.data))
+	}
+	if _, err := io.ReadFull(flate.NewReader(r), t.data); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
@@ -0,0 +1,301 @@
+package chester_test
+
+import (
+	"context"
+	"math/rand"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bluescreen10/chester"
+)
+
+// testTablebase is shared by the tests, generating it takes a while.
+var testTablebase = sync.OnceValues(func() (*chester.Tablebase, error) {
+	tb := chester.NewTablebase()
+	for _, code := range []string{"KQK", "KRK", "KPK"} {
+		if err := tb.Generate(code); err != nil {
+			return nil, err
+		}
+	}
+	return tb, nil
+})
+
+func TestTablebase_Generate(t *testing.T) {
+	tb, err := testTablebase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"KBK", "KNK", "KPK", "KQK", "KRK"}
+	if got := tb.Codes(); !slices.Equal(got, want) {
+		t.Errorf("got codes %v, want %v", got, want)
+	}
+
+	if err := chester.NewTablebase().Generate("KQRBK"); err == nil {
+		t.Errorf("generated a table with 5 pieces")
+	}
+}
+
+func TestTablebase_Probe(t *testing.T) {
+	tb, err := testTablebase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		fen string
+		wdl chester.WDL
+		dtm int
+		ok  bool
+	}{
+		{"k7/8/1K6/8/8/8/8/6Q1 w - - 0 1", chester.Win, 1, true},
+		{"k7/8/1K6/8/8/8/8/6Q1 b - - 0 1", chester.Loss, 2, true},
+		{"1Q6/k7/1K6/8/8/8/8/8 b - - 0 1", chester.Draw, 0, true},
+		{"k7/1Q6/1K6/8/8/8/8/8 b - - 0 1", chester.Loss, 0, true},
+		{"8/8/8/4k3/8/8/8/3QK3 w - - 0 1", chester.Win, 13, true},
+		{"3qk3/8/8/4K3/8/8/8/8 b - - 0 1", chester.Win, 13, true},
+		{"8/8/8/4k3/8/8/8/R3K3 b - - 0 1", chester.Loss, 28, true},
+		{"8/8/8/4k3/8/8/1P6/4K3 w - - 0 1", chester.Draw, 0, true},
+		{"8/8/8/8/8/8/P6k/K7 w - - 0 1", chester.Win, 27, true},
+		{"8/8/8/4k3/8/8/8/4K3 w - - 0 1", chester.Draw, 0, true},
+		{"8/8/8/3rk3/8/8/8/3QK3 w - - 0 1", chester.Draw, 0, false},
+		{"4k3/8/8/8/8/8/8/R3K3 w Q - 0 1", chester.Draw, 0, false},
+		{chester.DefaultFEN, chester.Draw, 0, false},
+	}
+
+	for _, test := range tests {
+		for _, fen := range []string{test.fen, mirrorFEN(test.fen), flipFilesFEN(test.fen)} {
+			p, err := chester.ParseFEN(fen)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			wdl, dtm, ok := tb.Probe(p)
+			if ok != test.ok || wdl != test.wdl || dtm != test.dtm {
+				t.Errorf("%s: got %v %d %v, want %v %d %v", fen, wdl, dtm, ok, test.wdl, test.dtm, test.ok)
+			}
+		}
+	}
+}
+
+// TestTablebase_Consistency checks random positions against their
+// successors: the result is the best one reachable in one move, with the
+// quickest mate when winning and the slowest when losing.
+func TestTablebase_Consistency(t *testing.T) {
+	tb, err := testTablebase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := rand.New(rand.NewSource(1))
+	for _, pieces := range []string{"KkQ", "KkR", "KkP"} {
+		for checked := 0; checked < 1000; {
+			var board [64]byte
+			for _, c := range []byte(pieces) {
+				sq := r.Intn(64)
+				for board[sq] != 0 || c == 'P' && (sq < 8 || sq >= 56) {
+					sq = r.Intn(64)
+				}
+				board[sq] = c
+			}
+
+			active := "w"
+			if r.Intn(2) == 0 {
+				active = "b"
+			}
+
+			p, err := chester.ParseFEN(boardFEN(board) + " " + active + " - - 0 1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !legalPosition(p) {
+				continue
+			}
+			checked++
+
+			wdl, dtm, ok := tb.Probe(p)
+			if !ok {
+				t.Fatalf("%s: not found", p.FEN())
+			}
+
+			wantWDL, wantDTM := successorsResult(t, tb, p)
+			if wdl != wantWDL || dtm != wantDTM {
+				t.Fatalf("%s: got %v %d, want %v %d from the moves", p.FEN(), wdl, dtm, wantWDL, wantDTM)
+			}
+		}
+	}
+}
+
+func TestTablebase_KPK(t *testing.T) {
+	tb, err := testTablebase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := rand.New(rand.NewSource(1))
+	for checked := 0; checked < 2000; {
+		var board [64]byte
+		wk, bk, pawn := r.Intn(64), r.Intn(64), 8+r.Intn(48)
+		if wk == bk || wk == pawn || bk == pawn {
+			continue
+		}
+		board[wk], board[bk], board[pawn] = 'K', 'k', 'P'
+
+		active := "w"
+		if r.Intn(2) == 0 {
+			active = "b"
+		}
+
+		p, err := chester.ParseFEN(boardFEN(board) + " " + active + " - - 0 1")
+		if err != nil || !validKPK(p) {
+			continue
+		}
+		checked++
+
+		wdl, _, _ := tb.Probe(p)
+		win := wdl == chester.Win && active == "w" || wdl == chester.Loss && active == "b"
+		if want := chester.ProbeKPK(p); win != want {
+			t.Fatalf("%s: got %v, want win %v", p.FEN(), wdl, want)
+		}
+	}
+}
+
+func TestTablebase_SaveLoad(t *testing.T) {
+	tb, err := testTablebase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	if err := tb.Save(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := chester.NewTablebase()
+	if err := loaded.Load(dir); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := loaded.Codes(), tb.Codes(); !slices.Equal(got, want) {
+		t.Fatalf("got codes %v, want %v", got, want)
+	}
+
+	for _, fen := range []string{
+		"8/8/8/4k3/8/8/8/3QK3 w - - 0 1",
+		"8/8/8/4k3/8/8/8/R3K3 b - - 0 1",
+		"8/8/8/8/8/8/P6k/K7 w - - 0 1",
+	} {
+		p, _ := chester.ParseFEN(fen)
+		wdl, dtm, ok := tb.Probe(p)
+		gotWDL, gotDTM, gotOK := loaded.Probe(p)
+		if gotWDL != wdl || gotDTM != dtm || gotOK != ok {
+			t.Errorf("%s: got %v %d %v after loading, want %v %d %v", fen, gotWDL, gotDTM, gotOK, wdl, dtm, ok)
+		}
+	}
+
+	if err := chester.NewTablebase().Load(t.TempDir()); err != nil {
+		t.Errorf("loading an empty directory: %v", err)
+	}
+}
+
+func TestTBScore(t *testing.T) {
+	// the longest table distance probed at the deepest ply is still a mate
+	for _, ply := range []int{1, 60, 128} {
+		for _, dtm := range []int{1, 100, 254} {
+			win, loss := chester.Score(chester.TBScore(chester.Win, dtm, ply)), chester.Score(chester.TBScore(chester.Loss, dtm, ply))
+			if want := (ply + dtm + 1) / 2; win.MateIn() != want {
+				t.Errorf("win in %d at ply %d: got mate in %d, want %d", dtm, ply, win.MateIn(), want)
+			}
+			if want := -(ply + dtm + 1) / 2; loss.MateIn() != want {
+				t.Errorf("loss in %d at ply %d: got mate in %d, want %d", dtm, ply, loss.MateIn(), want)
+			}
+		}
+	}
+}
+
+func TestSearch_Tablebase(t *testing.T) {
+	tb, err := testTablebase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the root is probed and the quickest mate played
+	p, _ := chester.ParseFEN("8/8/8/4k3/8/8/8/3QK3 w - - 0 1")
+	var observer countingObserver
+	p.SetObserver(&observer)
+	best, err := chester.Search(context.Background(), p, chester.SearchOptions{MaxDepth: 1, Tablebase: tb}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if observer != 0 {
+		t.Errorf("root: the observer was notified %d times by the search", observer)
+	}
+	if want := chester.MateScore - 13; best.Score != want {
+		t.Errorf("root: got score %d, want %d", best.Score, want)
+	}
+	p.Do(best.Best)
+	if wdl, dtm, _ := tb.Probe(p); wdl != chester.Loss || dtm != 12 {
+		t.Errorf("root: %s reached %v %d, want loss 12", best.Best, wdl, dtm)
+	}
+
+	// the queen is captured and the tablebase probed after it
+	p, _ = chester.ParseFEN("q6k/8/8/8/8/8/8/R3K3 w - - 0 1")
+	best, err = chester.Search(context.Background(), p, chester.SearchOptions{MaxDepth: 2, Tablebase: tb}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !best.Score.IsMate() || best.Score < 0 || best.Best.String() != "a1a8" {
+		t.Errorf("interior: got %s with score %d, want a1a8 and a mate", best.Best, best.Score)
+	}
+}
+
+// legalPosition reports whether the side that isn't to move isn't in
+// check and the kings aren't next to each other.
+func legalPosition(p *chester.Position) bool {
+	wk, _ := p.WhiteKing().PopLSB()
+	bk, _ := p.BlackKing().PopLSB()
+	wr, wf := wk.RankAndFile()
+	br, bf := bk.RankAndFile()
+	if max(wr-br, br-wr, wf-bf, bf-wf) <= 1 {
+		return false
+	}
+
+	// pass the move to look for checks of the other king
+	fen := strings.Fields(p.FEN())
+	fen[1] = map[string]string{"w": "b", "b": "w"}[fen[1]]
+	other, err := chester.ParseFEN(strings.Join(fen, " "))
+	return err == nil && !other.InCheck()
+}
+
+// successorsResult returns the result of p from the tablebase results of
+// its successors.
+func successorsResult(t *testing.T, tb *chester.Tablebase, p *chester.Position) (chester.WDL, int) {
+	moves, inCheck := chester.LegalMoves(nil, p)
+	if len(moves) == 0 {
+		if inCheck {
+			return chester.Loss, 0
+		}
+		return chester.Draw, 0
+	}
+
+	wdl, dtm := chester.Loss, 0
+	for _, m := range moves {
+		child := *p
+		child.Do(m)
+		childWDL, childDTM, ok := tb.Probe(&child)
+		if !ok {
+			t.Fatalf("%s: not found", child.FEN())
+		}
+
+		switch {
+		case childWDL == chester.Loss && (wdl != chester.Win || childDTM+1 < dtm):
+			wdl, dtm = chester.Win, childDTM+1
+		case childWDL == chester.Draw && wdl == chester.Loss:
+			wdl, dtm = chester.Draw, 0
+		case childWDL == chester.Win && wdl == chester.Loss:
+			dtm = max(dtm, childDTM+1)
+		}
+	}
+	return wdl, dtm
+}
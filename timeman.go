@@ -0,0 +1,156 @@
+package chester
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// defaultMovesToGo is the number of moves the remaining time is divided
+// into when the time control doesn't specify it.
+const defaultMovesToGo = 30
+
+// TimeControl describes the clock of the side to move.
+type TimeControl struct {
+	// Time is the time left on the clock.
+	Time time.Duration
+
+	// Increment is the time added to the clock after every move.
+	Increment time.Duration
+
+	// MovesToGo is the number of moves until the next time control. Zero
+	// means the rest of the game (sudden death).
+	MovesToGo int
+
+	// MoveOverhead is the time lost on every move outside of the search,
+	// like network lag, which is kept in reserve.
+	MoveOverhead time.Duration
+}
+
+// Limits returns the soft and hard time limits for the next move. The soft
+// limit is the time after which the search should not start a new
+// iteration, see [SearchOptions.SoftTime]. The hard limit is the time at
+// which the search must be aborted, see [SearchOptions.MaxTime].
+func (tc TimeControl) Limits() (soft, hard time.Duration) {
+	available := tc.Time - tc.MoveOverhead
+	if available <= 0 {
+		return time.Millisecond, time.Millisecond
+	}
+
+	movesToGo := tc.MovesToGo
+	if movesToGo <= 0 {
+		movesToGo = defaultMovesToGo
+	}
+
+	soft = available/time.Duration(movesToGo) + tc.Increment*8/10
+	soft = min(soft, available/2)
+	hard = min(soft*3, available*3/4)
+
+	return max(soft, time.Millisecond), max(hard, time.Millisecond)
+}
+
+// Scale factors applied by the time manager to the soft limit.
+const (
+	// unstableFactor is added for every recent best move change.
+	unstableFactor = 1.0
+
+	// scoreDropFactor is applied when the score drops by scoreDropMargin
+	// or more from the previous iteration.
+	scoreDropFactor = 1.5
+	scoreDropMargin = 30
+
+	// recaptureFactor is applied while a recapture has been the best move
+	// for the last stableIterations iterations.
+	recaptureFactor  = 0.25
+	stableIterations = 3
+
+	// maxTimeFactor limits how much the soft limit can be extended.
+	maxTimeFactor = 3.0
+)
+
+// timeManager decides, after every completed iteration, whether the search
+// should carry on. The soft limit is extended when the best move or the
+// score are unstable and cut short when there is nothing to think about.
+type timeManager struct {
+	// soft is the soft limit before scaling.
+	soft time.Duration
+
+	// start is the time, in nanoseconds since the epoch, when the clock
+	// started. It is zero while pondering.
+	start atomic.Int64
+
+	// bestMove and score are the results of the previous iteration.
+	bestMove Move
+	score    int
+
+	// changes is a decaying count of best move changes.
+	changes float64
+
+	// stable is the number of iterations the best move has not changed.
+	stable int
+}
+
+// newTimeManager returns a time manager for a search with the given soft
+// limit. The clock starts right away unless pondering.
+func newTimeManager(soft time.Duration, pondering bool) *timeManager {
+	tm := &timeManager{soft: soft}
+	if !pondering {
+		tm.startClock()
+	}
+	return tm
+}
+
+// startClock starts counting the time of the search.
+func (tm *timeManager) startClock() {
+	tm.start.Store(time.Now().UnixNano())
+}
+
+// stop records the result of the iteration just completed and reports
+// whether the search should stop instead of starting a new one.
+func (tm *timeManager) stop(p *Position, rootMoves int, best Move, score int) bool {
+	if best == tm.bestMove {
+		tm.stable++
+	} else {
+		if tm.bestMove != 0 {
+			tm.changes++
+		}
+		tm.stable = 0
+	}
+	tm.changes /= 2
+
+	factor := 1 + unstableFactor*tm.changes
+	if tm.bestMove != 0 && score <= tm.score-scoreDropMargin {
+		factor *= scoreDropFactor
+	}
+
+	if tm.stable >= stableIterations && isRecapture(p, best) {
+		factor *= recaptureFactor
+	}
+
+	tm.bestMove = best
+	tm.score = score
+
+	start := tm.start.Load()
+	if start == 0 {
+		return false
+	}
+
+	// there is nothing to think about with a single legal move
+	if rootMoves == 1 {
+		return true
+	}
+
+	elapsed := time.Since(time.Unix(0, start))
+	return elapsed > time.Duration(float64(tm.soft)*min(factor, maxTimeFactor))
+}
+
+// isRecapture reports whether m is a capture that restores the material
+// balance, which is usually the only sensible move after the opponent
+// captured a piece.
+func isRecapture(p *Position, m Move) bool {
+	if !isCapture(p, m) {
+		return false
+	}
+
+	material := EvalMaterial(p)
+	return material < 0 && material+seeValue[capturedPiece(p, m)] >= 0 && see(p, m) > 0
+}
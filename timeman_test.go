@@ -0,0 +1,108 @@
+package chester_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bluescreen10/chester"
+)
+
+func TestTimeControlLimits(t *testing.T) {
+	tests := []struct {
+		name     string
+		tc       chester.TimeControl
+		wantSoft time.Duration
+		wantHard time.Duration
+	}{
+		{
+			name:     "sudden death",
+			tc:       chester.TimeControl{Time: 60 * time.Second},
+			wantSoft: 2 * time.Second,
+			wantHard: 6 * time.Second,
+		},
+		{
+			name:     "increment",
+			tc:       chester.TimeControl{Time: 60 * time.Second, Increment: time.Second},
+			wantSoft: 2800 * time.Millisecond,
+			wantHard: 8400 * time.Millisecond,
+		},
+		{
+			name:     "moves to go",
+			tc:       chester.TimeControl{Time: 10 * time.Second, MovesToGo: 1},
+			wantSoft: 5 * time.Second,
+			wantHard: 7500 * time.Millisecond,
+		},
+		{
+			name:     "move overhead",
+			tc:       chester.TimeControl{Time: 3100 * time.Millisecond, MoveOverhead: 100 * time.Millisecond},
+			wantSoft: 100 * time.Millisecond,
+			wantHard: 300 * time.Millisecond,
+		},
+		{
+			name:     "no time left",
+			tc:       chester.TimeControl{Time: 50 * time.Millisecond, MoveOverhead: 100 * time.Millisecond},
+			wantSoft: time.Millisecond,
+			wantHard: time.Millisecond,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			soft, hard := test.tc.Limits()
+			if soft != test.wantSoft || hard != test.wantHard {
+				t.Errorf("got soft %s hard %s, want soft %s hard %s", soft, hard, test.wantSoft, test.wantHard)
+			}
+		})
+	}
+}
+
+func TestSearchBestMove_SoftTime(t *testing.T) {
+	p, _ := chester.ParseFEN("r2q1rk1/ppp2ppp/2np1n2/2b1p1B1/2B1P1b1/2NP1N2/PPP2PPP/R2Q1RK1 w - - 0 8")
+	opts := &chester.SearchOptions{
+		MaxDepth: 100,
+		MaxTime:  5 * time.Second,
+		SoftTime: 50 * time.Millisecond,
+	}
+
+	start := time.Now()
+	ch, _ := chester.SearchBestMove(p, opts)
+
+	var lastEval chester.Evaluation
+	for e := range ch {
+		lastEval = e
+	}
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("search ran for %s, want it to stop after the soft limit", elapsed)
+	}
+
+	if lastEval.Best == 0 {
+		t.Error("got no best move")
+	}
+}
+
+func TestSearchBestMove_SingleLegalMove(t *testing.T) {
+	// the black king can only step down the a-file
+	p, _ := chester.ParseFEN("k7/8/8/8/8/8/1R6/KR6 b - - 0 1")
+	opts := &chester.SearchOptions{
+		MaxDepth: 100,
+		MaxTime:  5 * time.Second,
+		SoftTime: time.Second,
+	}
+
+	start := time.Now()
+	ch, _ := chester.SearchBestMove(p, opts)
+
+	var lastEval chester.Evaluation
+	for e := range ch {
+		lastEval = e
+	}
+
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("search ran for %s with a single legal move", elapsed)
+	}
+
+	if lastEval.Best.String() != "a8a7" {
+		t.Errorf("got move %s, want a8a7", lastEval.Best)
+	}
+}
@@ -0,0 +1,195 @@
+package chester
+
+import (
+	"fmt"
+	"strings"
+)
+
+// termNames holds the names of the classical evaluation terms as shown in
+// an [EvalTrace].
+var termNames = [termCount]string{
+	termMaterial:      "Material",
+	termPassedPawns:   "Passed pawns",
+	termIsolatedPawns: "Isolated pawns",
+	termDoubledPawns:  "Doubled pawns",
+	termBackwardPawns: "Backward pawns",
+	termBishopPair:    "Bishop pair",
+	termRooks:         "Rooks",
+	termOutposts:      "Outposts",
+	termMobility:      "Mobility",
+	termKingSafety:    "King safety",
+	termThreats:       "Threats",
+	termTempo:         "Tempo",
+}
+
+// EvalTermTrace is the contribution of a single term to the evaluation.
+type EvalTermTrace struct {
+	// Name of the term.
+	Name string
+
+	// MG and EG are the midgame and endgame scores of each color.
+	MG, EG [Color(2)]int
+}
+
+// Tapered returns the score of the term from White's point of view,
+// interpolated by phase.
+func (t EvalTermTrace) Tapered(phase int) int {
+	mg := t.MG[White] - t.MG[Black]
+	eg := t.EG[White] - t.EG[Black]
+	return (mg*phase + eg*(24-phase)) / 24
+}
+
+// EvalTrace is a breakdown of the classical evaluation of a position, term
+// by term. See [TraceEval].
+type EvalTrace struct {
+	// Terms holds every term of the evaluation.
+	Terms []EvalTermTrace
+
+	// Phase is the game phase, from 24 in the opening to 0 when only
+	// kings and pawns are left. Midgame scores weigh Phase/24 and endgame
+	// scores the rest.
+	Phase int
+
+	// Score is the final evaluation from the side to move perspective, as
+	// returned by [EvalClassical].
+	Score int
+
+	// Active is the side to move.
+	Active Color
+
+	// Scale is the factor, out of [ScaleNormal], the endgame score of the
+	// side ahead is scaled by.
+	Scale int
+
+	// Endgame is set when the position is a known endgame, whose Score
+	// comes from its specialized evaluation instead of the terms.
+	Endgame bool
+}
+
+// TraceEval evaluates p with [EvalClassical] and returns the breakdown of
+// the evaluation.
+func TraceEval(p *Position) EvalTrace {
+	var e classicalEval
+	e.evaluate(p)
+
+	trace := EvalTrace{
+		Terms:  make([]EvalTermTrace, termCount),
+		Phase:  e.phase(),
+		Score:  e.score(),
+		Active: p.active,
+		Scale:  ScaleNormal,
+	}
+
+	for term := range termCount {
+		trace.Terms[term].Name = termNames[term]
+		for color := range Color(2) {
+			trace.Terms[term].MG[color] = e.terms[term][color].mg
+			trace.Terms[term].EG[color] = e.terms[term][color].eg
+		}
+	}
+
+	return trace
+}
+
+// TracePesto evaluates p with the PeSTO evaluation the search uses by
+// default, with params or the default parameters when nil, and returns the
+// breakdown of the evaluation: the piece values, the piece-square tables
+// and the material imbalance, whose net value is in the White columns.
+func TracePesto(p *Position, params *EvalParams) EvalTrace {
+	t := pesto
+	if params != nil {
+		t = params.compile()
+	} else {
+		params = DefaultEvalParams()
+	}
+
+	material := pestoMaterialTable().Probe(p)
+	trace := EvalTrace{
+		Terms:  []EvalTermTrace{{Name: "Material"}, {Name: "Piece-square"}, {Name: "Imbalance"}},
+		Phase:  t.phase(p, material),
+		Active: p.active,
+	}
+
+	for color := range Color(2) {
+		for piece := Pawn; piece <= King; piece++ {
+			bb := p.pieces[piece] & p.allPieces[color]
+			for bb != 0 {
+				var sq Square
+				sq, bb = bb.PopLSB()
+				trace.Terms[0].MG[color] += params.MGValue[piece]
+				trace.Terms[0].EG[color] += params.EGValue[piece]
+				trace.Terms[1].MG[color] += t.mg[color][piece][sq] - params.MGValue[piece]
+				trace.Terms[1].EG[color] += t.eg[color][piece][sq] - params.EGValue[piece]
+			}
+		}
+	}
+	trace.Terms[2].MG[White], trace.Terms[2].EG[White] = material.Imbalance()
+
+	var mg, eg int
+	for _, term := range trace.Terms {
+		mg += term.MG[White] - term.MG[Black]
+		eg += term.EG[White] - term.EG[Black]
+	}
+
+	strong := White
+	if eg < 0 {
+		strong = Black
+	}
+	trace.Scale = material.Scale(p, strong)
+	_, trace.Endgame = material.Endgame(p)
+
+	// the imbalance is added again by taper
+	trace.Score = t.taper(p, mg-trace.Terms[2].MG[White], eg-trace.Terms[2].EG[White])
+	return trace
+}
+
+// String formats the trace as a table, in pawns, with the scores of each
+// term per color, their difference and the tapered total.
+func (t EvalTrace) String() string {
+	var sb strings.Builder
+
+	line := "---------------+-------------+-------------+-------------+--------\n"
+	sb.WriteString("          Term |    White    |    Black    |    Total    | Tapered\n")
+	sb.WriteString("               |   MG    EG  |   MG    EG  |   MG    EG  |\n")
+	sb.WriteString(line)
+
+	var total EvalTermTrace
+	for _, term := range t.Terms {
+		writeTraceRow(&sb, term, t.Phase)
+		for color := range Color(2) {
+			total.MG[color] += term.MG[color]
+			total.EG[color] += term.EG[color]
+		}
+	}
+
+	sb.WriteString(line)
+	total.Name = "Total"
+	writeTraceRow(&sb, total, t.Phase)
+
+	fmt.Fprintf(&sb, "\nPhase: %d/24\n", t.Phase)
+	if t.Scale != ScaleNormal {
+		fmt.Fprintf(&sb, "Endgame scale: %d/%d\n", t.Scale, ScaleNormal)
+	}
+	if t.Endgame {
+		sb.WriteString("Known endgame, evaluated by its specialized function\n")
+	}
+
+	white := t.Score
+	if t.Active == Black {
+		white = -white
+	}
+	fmt.Fprintf(&sb, "Final evaluation: %+.2f (white side)\n", float64(white)/100)
+
+	return sb.String()
+}
+
+// writeTraceRow writes a row of the trace table for term.
+func writeTraceRow(sb *strings.Builder, term EvalTermTrace, phase int) {
+	pawns := func(cp int) float64 { return float64(cp) / 100 }
+	fmt.Fprintf(sb, "%14s | %5.2f %5.2f | %5.2f %5.2f | %5.2f %5.2f | %6.2f\n",
+		term.Name,
+		pawns(term.MG[White]), pawns(term.EG[White]),
+		pawns(term.MG[Black]), pawns(term.EG[Black]),
+		pawns(term.MG[White]-term.MG[Black]), pawns(term.EG[White]-term.EG[Black]),
+		pawns(term.Tapered(phase)))
+}
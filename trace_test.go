@@ -0,0 +1,132 @@
+package chester_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bluescreen10/chester"
+)
+
+func TestTraceEval(t *testing.T) {
+	fens := []string{
+		chester.DefaultFEN,
+		"r2q1rk1/ppp2ppp/2np1n2/2b1p1B1/2B1P1b1/2NP1N2/PPP2PPP/R2Q1RK1 w - - 0 8",
+		"r2q1rk1/ppp2ppp/2np1n2/2b1p1B1/2B1P1b1/2NP1N2/PPP2PPP/R2Q1RK1 b - - 0 8",
+		"8/5k2/3p4/1p1Pp2p/pP2Pp1P/P4P1K/8/8 b - - 0 1",
+		"4k3/8/8/8/3P4/8/8/4K3 w - - 0 1",
+	}
+
+	for _, fen := range fens {
+		pos, err := chester.ParseFEN(fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		trace := chester.TraceEval(pos)
+		if want := chester.EvalClassical(pos); trace.Score != want {
+			t.Errorf("%s: got score %d, want %d", fen, trace.Score, want)
+		}
+
+		var total chester.EvalTermTrace
+		for _, term := range trace.Terms {
+			if term.Name == "" {
+				t.Errorf("%s: unnamed term", fen)
+			}
+			for color := range chester.Color(2) {
+				total.MG[color] += term.MG[color]
+				total.EG[color] += term.EG[color]
+			}
+		}
+
+		score := total.Tapered(trace.Phase)
+		if trace.Active == chester.Black {
+			score = -score
+		}
+		if score != trace.Score {
+			t.Errorf("%s: terms add up to %d, want %d", fen, score, trace.Score)
+		}
+
+		if trace.Phase < 0 || trace.Phase > 24 {
+			t.Errorf("%s: invalid phase %d", fen, trace.Phase)
+		}
+	}
+}
+
+func TestTraceEval_String(t *testing.T) {
+	pos, _ := chester.ParseFEN(chester.DefaultFEN)
+	table := chester.TraceEval(pos).String()
+
+	for _, want := range []string{"Material", "Mobility", "King safety", "Total", "Phase: 24/24", "Final evaluation: +0.20"} {
+		if !strings.Contains(table, want) {
+			t.Errorf("missing %q in:\n%s", want, table)
+		}
+	}
+}
+
+func TestTracePesto(t *testing.T) {
+	fens := []string{
+		chester.DefaultFEN,
+		"r2q1rk1/ppp2ppp/2np1n2/2b1p1B1/2B1P1b1/2NP1N2/PPP2PPP/R2Q1RK1 b - - 0 8",
+		"8/5k2/3p4/1p1Pp2p/pP2Pp1P/P4P1K/8/8 b - - 0 1",
+		"4k3/8/8/8/8/8/8/2B1KB2 w - - 0 1",
+		"4k3/8/8/8/8/8/8/4KR2 w - - 0 1",
+	}
+
+	params := chester.DefaultEvalParams()
+	params.MGValue[chester.Knight] += 50
+	params.EGTable[chester.King][chester.SQ_E1] -= 20
+	params.PhaseInc[chester.Queen] = 2
+
+	for _, fen := range fens {
+		pos, _ := chester.ParseFEN(fen)
+
+		trace := chester.TracePesto(pos, nil)
+		if want := chester.EvalPesto(pos); trace.Score != want {
+			t.Errorf("%s: got score %d, want %d", fen, trace.Score, want)
+		}
+
+		eval := chester.NewPestoEvaluatorWithParams(params)
+		eval.Reset(pos)
+		if got, want := chester.TracePesto(pos, params).Score, eval.Evaluate(pos); got != want {
+			t.Errorf("%s: got score %d with params, want %d", fen, got, want)
+		}
+
+		// unless scaled or overridden, the terms add up to the score
+		if trace.Endgame || trace.Scale != chester.ScaleNormal {
+			continue
+		}
+		var total chester.EvalTermTrace
+		for _, term := range trace.Terms {
+			for color := range chester.Color(2) {
+				total.MG[color] += term.MG[color]
+				total.EG[color] += term.EG[color]
+			}
+		}
+		score := total.Tapered(trace.Phase)
+		if trace.Active == chester.Black {
+			score = -score
+		}
+		if score != trace.Score {
+			t.Errorf("%s: terms add up to %d, want %d", fen, score, trace.Score)
+		}
+	}
+}
+
+func TestTracePesto_String(t *testing.T) {
+	tests := map[string][]string{
+		chester.DefaultFEN:                 {"Material", "Piece-square", "Imbalance", "Phase: 24/24"},
+		"4k3/8/8/8/8/8/8/4KR2 w - - 0 1":   {"Known endgame"},
+		"4k3/8/8/8/8/8/8/2B1KB2 w - - 0 1": {"Phase: 2/24"},
+		"4k3/8/8/8/8/8/8/2N1KN2 w - - 0 1": {"Known endgame"},
+	}
+
+	for fen, wants := range tests {
+		pos, _ := chester.ParseFEN(fen)
+		table := chester.TracePesto(pos, nil).String()
+		for _, want := range wants {
+			if !strings.Contains(table, want) {
+				t.Errorf("%s: missing %q in:\n%s", fen, want, table)
+			}
+		}
+	}
+}
@@ -1,7 +1,7 @@
 package chester
 
 import (
-	"sync"
+	"sync/atomic"
 	"unsafe"
 )
 
@@ -9,15 +9,17 @@ import (
 type ttFlag uint8
 
 const (
-	exact      ttFlag = iota // Score is an exact value (PV-node)
+	noBound    ttFlag = iota // Empty entry
+	exact                    // Score is an exact value (PV-node)
 	upperBound               // Score is an upper bound (Alpha-node)
 	lowerBound               // Score is a lower bound (Beta-node)
 )
 
-// ttEntry represents a single record in the transposition table.
+// ttEntry is the unpacked view of a single record in the transposition
+// table.
 type ttEntry struct {
-	// hash is the full Zobrist hash of the position to verify no collisions.
-	hash uint64
+	// move is the best move found for the position, or zero if unknown.
+	move Move
 
 	// score is the evaluation score found during search.
 	score int
@@ -29,48 +31,193 @@ type ttEntry struct {
 	flag ttFlag
 }
 
+// Entries are packed in a single 64 bit word so they can be read and written
+// atomically without locks:
+//
+//	63       58 57 56 55       48 47            32 31            16 15             0
+//	+----------+-----+-----------+----------------+----------------+----------------+
+//	|generation|bound|   depth   |     score      |      move      |      key       |
+//	+----------+-----+-----------+----------------+----------------+----------------+
+//
+// key holds the upper 16 bits of the Zobrist hash. The lower bits select the
+// bucket, so together they verify the entry belongs to the probed position.
+const (
+	ttMoveShift  = 16
+	ttScoreShift = 32
+	ttDepthShift = 48
+	ttBoundShift = 56
+	ttGenShift   = 58
+
+	// ttGenerations is the number of distinct generations an entry can
+	// record before the counter wraps around.
+	ttGenerations = 64
+
+	// ttBucketSize is the number of entries in a bucket. A bucket fills
+	// exactly one 64 byte cache line.
+	ttBucketSize = 8
+)
+
+// ttBucket groups the entries that share the same index so a probe touches
+// a single cache line.
+type ttBucket [ttBucketSize]atomic.Uint64
+
 // TranspositionTable is a thread-safe hash table used to store and retrieve
 // search results for previously visited positions. It helps avoid redundant
 // work by providing instant lookups for known positions at equal or greater
 // depth.
+//
+// Entries are accessed atomically so the table can be shared by several
+// search threads without locking. When a bucket is full, the entry with the
+// lowest depth, giving preference to entries from older searches, is
+// replaced.
 type TranspositionTable struct {
-	entries []ttEntry
-	size    uint64
-	mu      sync.RWMutex
+	buckets    []ttBucket
+	mask       uint64
+	generation atomic.Uint32
 }
 
 // NewTranspositionTable creates a new transposition table with the given
-// maximum size in bytes. The actual number of entries is rounded down to
+// maximum size in bytes. The actual number of buckets is rounded down to
 // the nearest power of two to allow for efficient indexing.
 func NewTranspositionTable(maxSize uint64) *TranspositionTable {
-	count := maxSize / uint64(unsafe.Sizeof(ttEntry{}))
+	tt := &TranspositionTable{}
+	tt.Resize(maxSize)
+	return tt
+}
+
+// Resize reallocates the table to the given maximum size in bytes,
+// discarding all the stored entries. It must not be called while a search
+// is using the table.
+func (tt *TranspositionTable) Resize(maxSize uint64) {
+	count := maxSize / uint64(unsafe.Sizeof(ttBucket{}))
 
 	// Round down to power of 2
 	size := uint64(1)
-	for size*2 <= uint64(count) {
+	for size*2 <= count {
 		size *= 2
 	}
 
-	return &TranspositionTable{
-		entries: make([]ttEntry, size),
-		size:    size,
+	tt.buckets = make([]ttBucket, size)
+	tt.mask = size - 1
+	tt.generation.Store(0)
+}
+
+// Clear removes all the entries from the table. It must not be called while
+// a search is using the table.
+func (tt *TranspositionTable) Clear() {
+	for i := range tt.buckets {
+		for j := range tt.buckets[i] {
+			tt.buckets[i][j].Store(0)
+		}
+	}
+	tt.generation.Store(0)
+}
+
+// NewSearch bumps the table generation. It is called at the beginning of
+// every search so entries left over from previous searches are replaced
+// first.
+func (tt *TranspositionTable) NewSearch() {
+	tt.generation.Store((tt.generation.Load() + 1) % ttGenerations)
+}
+
+// Hashfull returns an estimation of the table usage in permille, counting
+// the entries written during the current search.
+func (tt *TranspositionTable) Hashfull() int {
+	const samples = 1000 / ttBucketSize
+
+	buckets := min(len(tt.buckets), samples)
+	generation := uint8(tt.generation.Load())
+	used := 0
+	for i := range buckets {
+		for j := range tt.buckets[i] {
+			data := tt.buckets[i][j].Load()
+			if ttFlag(data>>ttBoundShift&3) != noBound && uint8(data>>ttGenShift) == generation {
+				used++
+			}
+		}
 	}
+
+	return used * 1000 / (buckets * ttBucketSize)
 }
 
 // get retrieves the entry associated with the given hash from the table.
-// If no entry is found or a collision occurs, it returns a zero-valued entry.
-func (tt *TranspositionTable) get(hash uint64) ttEntry {
-	tt.mu.RLock()
-	entry := tt.entries[hash%tt.size]
-	tt.mu.RUnlock()
+// It reports false if the position is not stored.
+func (tt *TranspositionTable) get(hash uint64) (ttEntry, bool) {
+	bucket := &tt.buckets[hash&tt.mask]
+	key := uint16(hash >> 48)
 
-	return entry
+	for i := range bucket {
+		data := bucket[i].Load()
+		if uint16(data) == key && ttFlag(data>>ttBoundShift&3) != noBound {
+			return unpackEntry(data), true
+		}
+	}
+
+	return ttEntry{}, false
+}
+
+// set stores an entry for the given hash. An existing entry for the same
+// position is only overwritten by a search at least as deep or by a newer
+// search. Otherwise the least valuable entry of the bucket is replaced.
+func (tt *TranspositionTable) set(hash uint64, entry ttEntry) {
+	bucket := &tt.buckets[hash&tt.mask]
+	key := uint16(hash >> 48)
+	generation := uint8(tt.generation.Load())
+
+	replace := 0
+	replaceValue := 1 << 30
+
+	for i := range bucket {
+		data := bucket[i].Load()
+		flag := ttFlag(data >> ttBoundShift & 3)
+
+		if flag == noBound {
+			replace = i
+			break
+		}
+
+		old := unpackEntry(data)
+		age := int((generation - uint8(data>>ttGenShift)) % ttGenerations)
+
+		if uint16(data) == key {
+			if entry.depth < old.depth && age == 0 && entry.flag != exact {
+				return
+			}
+
+			// keep the best move when the new entry does not have one
+			if entry.move == 0 {
+				entry.move = old.move
+			}
+			replace = i
+			break
+		}
+
+		// prefer replacing shallow entries from older searches
+		if value := old.depth - 8*age; value < replaceValue {
+			replaceValue = value
+			replace = i
+		}
+	}
+
+	bucket[replace].Store(packEntry(key, entry, generation))
+}
+
+// packEntry encodes entry into a single 64 bit word.
+func packEntry(key uint16, entry ttEntry, generation uint8) uint64 {
+	return uint64(key) |
+		uint64(entry.move)<<ttMoveShift |
+		uint64(uint16(int16(entry.score)))<<ttScoreShift |
+		uint64(uint8(min(entry.depth, 255)))<<ttDepthShift |
+		uint64(entry.flag)<<ttBoundShift |
+		uint64(generation)<<ttGenShift
 }
 
-// set stores a new entry in the transposition table, overwriting any
-// existing entry at the same index.
-func (tt *TranspositionTable) set(entry ttEntry) {
-	tt.mu.Lock()
-	tt.entries[entry.hash%tt.size] = entry
-	tt.mu.Unlock()
+// unpackEntry decodes an entry previously encoded with packEntry.
+func unpackEntry(data uint64) ttEntry {
+	return ttEntry{
+		move:  Move(data >> ttMoveShift),
+		score: int(int16(data >> ttScoreShift)),
+		depth: int(uint8(data >> ttDepthShift)),
+		flag:  ttFlag(data >> ttBoundShift & 3),
+	}
 }
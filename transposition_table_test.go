@@ -0,0 +1,54 @@
+package chester_test
+
+import (
+	"testing"
+
+	"github.com/bluescreen10/chester"
+)
+
+func TestTranspositionTableHashfull(t *testing.T) {
+	tt := chester.NewTranspositionTable(64 * 1024)
+
+	if got := tt.Hashfull(); got != 0 {
+		t.Fatalf("Hashfull() on empty table got %d, want 0", got)
+	}
+
+	p, _ := chester.ParseFEN("r1bq1rk1/pp2bppp/2n1pn2/3p4/2PP4/2N1PN2/PP3PPP/R2QKB1R w KQ - 0 8")
+	ch, _ := chester.SearchBestMove(p, &chester.SearchOptions{
+		MaxDepth:           4,
+		TranspositionTable: tt,
+	})
+	for range ch {
+	}
+
+	if got := tt.Hashfull(); got == 0 {
+		t.Fatalf("Hashfull() after search got 0, want > 0")
+	}
+
+	tt.NewSearch()
+	if got := tt.Hashfull(); got != 0 {
+		t.Fatalf("Hashfull() after NewSearch got %d, want 0", got)
+	}
+
+	tt.Resize(128 * 1024)
+	if got := tt.Hashfull(); got != 0 {
+		t.Fatalf("Hashfull() after Resize got %d, want 0", got)
+	}
+}
+
+func TestTranspositionTableClear(t *testing.T) {
+	tt := chester.NewTranspositionTable(64 * 1024)
+
+	p, _ := chester.ParseFEN("r1bq1rk1/pp2bppp/2n1pn2/3p4/2PP4/2N1PN2/PP3PPP/R2QKB1R w KQ - 0 8")
+	ch, _ := chester.SearchBestMove(p, &chester.SearchOptions{
+		MaxDepth:           3,
+		TranspositionTable: tt,
+	})
+	for range ch {
+	}
+
+	tt.Clear()
+	if got := tt.Hashfull(); got != 0 {
+		t.Fatalf("Hashfull() after Clear got %d, want 0", got)
+	}
+}